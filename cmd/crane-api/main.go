@@ -1,15 +1,247 @@
 package main
 
 import (
-	"html"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	_ "github.com/lib/pq"
+
+	"github.com/nabutabu/crane-oss/internal/budget"
+	"github.com/nabutabu/crane-oss/internal/config"
+	"github.com/nabutabu/crane-oss/internal/execute"
+	cataloghttp "github.com/nabutabu/crane-oss/internal/hostcatalog/http"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/service"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/internal/leader"
+	"github.com/nabutabu/crane-oss/internal/logging"
+	"github.com/nabutabu/crane-oss/internal/metrics"
+	"github.com/nabutabu/crane-oss/internal/provider"
+	"github.com/nabutabu/crane-oss/internal/provider/fake"
+	"github.com/nabutabu/crane-oss/internal/tracing"
+	"github.com/nabutabu/crane-oss/pkg/reconcile"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+const usage = `usage: crane-api [command]
+
+commands:
+  serve                    run the API server, reconciler and workers (default)
+  migrate up|down|status   manage the database schema
+  plan [-json]             show the actions a reconcile would enqueue
+`
+
 func main() {
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Healthy, %q", html.EscapeString(r.URL.Path))
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("load config: %v", err)
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// also routes the log package, and anything not handed a logger
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "serve":
+		err = serve(ctx, cfg, logger)
+	case "migrate":
+		err = migrateCmd(ctx, cfg, logger, args)
+	case "plan":
+		err = planCmd(ctx, cfg, logger, args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		logger.Error(cmd+" failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func openDB(ctx context.Context, cfg *config.Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping database: %w", err)
+	}
+
+	return db, nil
+}
+
+func serve(ctx context.Context, cfg *config.Config, logger *slog.Logger) error {
+	shutdownTracing, err := tracing.Setup(ctx, cfg.TraceExporter)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// ctx is done by now, but buffered spans still need flushing
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			logger.Warn("flush traces", "error", err)
+		}
+	}()
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	hostStore := store.NewPostgresHostStore(db)
+	hostStore.Logger = logger
+	actionStore := execute.NewPostgresActionStore(db)
+	actionStore.Logger = logger
+	catalogOpts := []service.Option{service.WithLogger(logger)}
+	if cfg.HealthDrivesState {
+		catalogOpts = append(catalogOpts, service.WithHealthDrivenState())
+	}
+	catalog := service.NewHostCatalogService(hostStore, catalogOpts...)
+	providers := provider.NewRegistry()
+	if cfg.FakeProvider {
+		providers.Register(fake.Name, fake.New(fake.Config{
+			BootLatency: cfg.FakeBootLatency,
+			FailureRate: cfg.FakeBootFailureRate,
+		}))
+	}
+	executor := execute.NewDefaultExecutor(catalog, providers, execute.ExecutorConfig{
+		DrainPeriod:  cfg.DrainPeriod,
+		ReadyTimeout: cfg.ReadyTimeout,
 	})
+	reconcileOpts := []reconcile.Option{reconcile.WithLogger(logger)}
+	var gate execute.Gate
+	if len(cfg.DisruptionBudgets) > 0 {
+		budgets := budget.NewChecker(cfg.DisruptionBudgets)
+		reconcileOpts = append(reconcileOpts, reconcile.WithBudgets(budgets))
+		gate = budget.NewGate(budgets, hostStore, actionStore)
+	}
+	reconciler := reconcile.NewDefaultHostReconciler(hostStore, actionStore, reconcileOpts...)
+	listener := store.NewHostListener(cfg.DatabaseURL)
+	listener.Logger = logger
+	runner := reconcile.NewRunner(reconciler, cfg.ReconcileInterval,
+		reconcile.WithSource(listener),
+		reconcile.WithWorkers(cfg.ReconcileWorkers),
+		reconcile.WithRunnerLogger(logger))
+	workers := execute.NewWorkerPool(actionStore, executor, execute.WorkerPoolConfig{
+		Size:            cfg.Workers,
+		PollInterval:    cfg.WorkerPollInterval,
+		MaxPollInterval: cfg.WorkerMaxPollInterval,
+		Lease:           cfg.ActionLease,
+		Gate:            gate,
+		Logger:          logger,
+	})
+	janitor := execute.NewJanitor(actionStore, cfg.ActionLease/2)
+	janitor.Logger = logger
+	elector := newElector(db, cfg)
+	elector.Logger = logger
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	catalogHandler := cataloghttp.NewHandler(catalog)
+	catalogHandler.Logger = logger
+	catalogHandler.Register(mux)
+	planHandler := cataloghttp.NewPlanHandler(reconciler)
+	planHandler.Logger = logger
+	planHandler.Register(mux)
+	mux.Handle("GET /leader", elector)
+	mux.Handle("GET /v1/reconcile/status", runner)
+	mux.Handle("GET /metrics", metrics.Handler())
+	collector := metrics.NewCollector(hostStore, actionStore)
+	collector.Logger = logger
+	prometheus.MustRegister(collector)
+
+	server := &http.Server{
+		Addr:    cfg.HTTPAddr,
+		Handler: logging.Middleware(logger, metrics.Instrument(mux)),
+	}
+
+	// background loops stop as soon as either a signal arrives or the
+	// HTTP server fails.
+	bgCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	// only the leader reconciles; workers run everywhere since claims are
+	// exclusive
+	wg.Go(func() {
+		elector.Run(bgCtx, runner.Run)
+	})
+	wg.Go(func() {
+		workers.Run(bgCtx)
+	})
+	wg.Go(func() {
+		janitor.Run(bgCtx)
+	})
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("crane-api listening", "addr", cfg.HTTPAddr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	select {
+	case <-ctx.Done():
+		logger.Info("shutting down")
+	case err = <-serverErr:
+	}
+
+	cancel()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer shutdownCancel()
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		err = errors.Join(err, fmt.Errorf("shutdown http server: %w", shutdownErr))
+	}
+
+	wg.Wait()
+	return err
+}
+
+func newElector(db *sql.DB, cfg *config.Config) *leader.Elector {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	id := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+
+	var lock leader.Lock
+	switch cfg.LeaderElection {
+	case "advisory":
+		lock = leader.NewAdvisoryLock(db, leader.LockName)
+	case "lease":
+		lock = leader.NewLeaseLock(db, leader.LockName, id, cfg.LeaderLease)
+	default:
+		lock = leader.NoopLock{}
+	}
 
-	log.Fatal(http.ListenAndServe(":43060", nil))
+	return leader.NewElector(lock, id, cfg.LeaderElection, cfg.LeaderLease)
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/config"
+	"github.com/nabutabu/crane-oss/internal/migrate"
+)
+
+func migrateCmd(ctx context.Context, cfg *config.Config, logger *slog.Logger, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: crane-api migrate up|down|status")
+	}
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db)
+	if err != nil {
+		return err
+	}
+	migrator.Logger = logger
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+	case "down":
+		rolledBack, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if rolledBack == nil {
+			fmt.Println("no migrations to roll back")
+		} else {
+			fmt.Printf("rolled back %04d_%s\n", rolledBack.Version, rolledBack.Name)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nabutabu/crane-oss/internal/budget"
+	"github.com/nabutabu/crane-oss/internal/config"
+	"github.com/nabutabu/crane-oss/internal/execute"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/pkg/reconcile"
+)
+
+func planCmd(ctx context.Context, cfg *config.Config, logger *slog.Logger, args []string) error {
+	flags := flag.NewFlagSet("plan", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the plan as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	hostStore := store.NewPostgresHostStore(db)
+	hostStore.Logger = logger
+	actionStore := execute.NewPostgresActionStore(db)
+	actionStore.Logger = logger
+
+	opts := []reconcile.Option{reconcile.WithLogger(logger)}
+	if len(cfg.DisruptionBudgets) > 0 {
+		opts = append(opts, reconcile.WithBudgets(budget.NewChecker(cfg.DisruptionBudgets)))
+	}
+	reconciler := reconcile.NewDefaultHostReconciler(hostStore, actionStore, opts...)
+	plan, err := reconciler.Plan(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+
+	if len(plan.Actions) == 0 {
+		fmt.Printf("no changes, %d hosts up to date\n", plan.Hosts)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tSTATE\tHEALTH\tACTION\tREASON\tBLOCKED BY")
+	for _, a := range plan.Actions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", a.HostID, a.State, a.Health, a.Action, a.Reason, a.BlockedBy)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d actions for %d hosts\n", len(plan.Actions), plan.Hosts)
+	return nil
+}
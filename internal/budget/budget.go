@@ -0,0 +1,206 @@
+// Package budget limits how many hosts automation may take out of service at
+// once. A Budget covers the hosts matching its fleet, role and zone
+// selectors and caps how many of them may be unavailable at the same time.
+package budget
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+// Each, used as a selector, applies the budget separately to every distinct
+// value of that attribute, e.g. Zone: Each limits every zone on its own.
+const Each = "*"
+
+// ErrBudgetExceeded is wrapped by *BlockedError.
+var ErrBudgetExceeded = errors.New("disruption budget exceeded")
+
+// Limit is a maximum number of unavailable hosts, either absolute or as a
+// percentage of the hosts a budget covers.
+type Limit struct {
+	Count   int
+	Percent int
+}
+
+// ParseLimit parses "3" or "25%".
+func ParseLimit(s string) (Limit, error) {
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		n, err := strconv.Atoi(pct)
+		if err != nil || n < 0 || n > 100 {
+			return Limit{}, fmt.Errorf("invalid percentage %q", s)
+		}
+		return Limit{Percent: n}, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q", s)
+	}
+	return Limit{Count: n}, nil
+}
+
+func (l Limit) String() string {
+	if l.Percent != 0 {
+		return strconv.Itoa(l.Percent) + "%"
+	}
+	return strconv.Itoa(l.Count)
+}
+
+func (l Limit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+func (l *Limit) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		// allow plain numbers as well as strings
+		s = string(b)
+	}
+
+	parsed, err := ParseLimit(s)
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// Allowed returns how many of total hosts may be unavailable. Percentages
+// round up, so a non-zero percentage always allows at least one host.
+func (l Limit) Allowed(total int) int {
+	if l.Percent != 0 {
+		return (total*l.Percent + 99) / 100
+	}
+	return l.Count
+}
+
+type Budget struct {
+	Name string `json:"name"`
+	// Fleet, Role and Zone select the hosts the budget covers. Empty
+	// matches any value; Each applies the budget per distinct value.
+	Fleet          string `json:"fleet,omitempty"`
+	Role           string `json:"role,omitempty"`
+	Zone           string `json:"zone,omitempty"`
+	MaxUnavailable Limit  `json:"max_unavailable"`
+}
+
+// Parse decodes a JSON list of budgets, as found in
+// CRANE_DISRUPTION_BUDGETS.
+func Parse(s string) ([]Budget, error) {
+	var budgets []Budget
+	if err := json.Unmarshal([]byte(s), &budgets); err != nil {
+		return nil, fmt.Errorf("parse disruption budgets: %w", err)
+	}
+
+	for i, b := range budgets {
+		if b.Name == "" {
+			return nil, fmt.Errorf("disruption budget %d has no name", i)
+		}
+	}
+	return budgets, nil
+}
+
+// group returns the group of host within b, or false if b does not cover
+// host.
+func (b Budget) group(host *api.Host) (string, bool) {
+	var group []string
+	for _, sel := range []struct{ key, selector, value string }{
+		{"fleet", b.Fleet, host.Fleet.Name},
+		{"role", b.Role, host.Role.Name},
+		{"zone", b.Zone, host.Zone},
+	} {
+		switch sel.selector {
+		case "":
+		case Each:
+			group = append(group, sel.key+"="+sel.value)
+		default:
+			if sel.selector != sel.value {
+				return "", false
+			}
+			group = append(group, sel.key+"="+sel.value)
+		}
+	}
+	return strings.Join(group, ","), true
+}
+
+// BlockedError reports the budget that kept a host from being disrupted.
+type BlockedError struct {
+	Budget      string
+	Group       string
+	Unavailable int
+	Allowed     int
+}
+
+func (e *BlockedError) Error() string {
+	group := ""
+	if e.Group != "" {
+		group = " (" + e.Group + ")"
+	}
+	return fmt.Sprintf("disruption budget %q%s allows %d unavailable hosts, %d already are", e.Budget, group, e.Allowed, e.Unavailable)
+}
+
+func (e *BlockedError) Unwrap() error {
+	return ErrBudgetExceeded
+}
+
+// Checker decides whether taking a host out of service stays within every
+// budget.
+type Checker struct {
+	budgets []Budget
+}
+
+func NewChecker(budgets []Budget) *Checker {
+	return &Checker{budgets: budgets}
+}
+
+// Check reports whether host may be disrupted given the current hosts and
+// the IDs of hosts that actions are already disrupting. It returns a
+// *BlockedError naming the first budget that would be exceeded.
+//
+// Only READY hosts count as available; PROVISIONING and TERMINATED hosts are
+// not counted at all. Disrupting a host that is already unavailable is
+// always allowed.
+func (c *Checker) Check(host *api.Host, hosts []*api.Host, disrupted map[string]bool) error {
+	if host.State != api.HostReady {
+		return nil
+	}
+
+	for _, b := range c.budgets {
+		group, ok := b.group(host)
+		if !ok {
+			continue
+		}
+
+		total, unavailable := 0, 0
+		for _, h := range hosts {
+			if h.State == api.HostProvisioning || h.State == api.HostTerminated {
+				continue
+			}
+			if g, ok := b.group(h); !ok || g != group {
+				continue
+			}
+
+			total++
+			if h.ID != host.ID && (h.State != api.HostReady || disrupted[h.ID]) {
+				unavailable++
+			}
+		}
+
+		allowed := b.MaxUnavailable.Allowed(total)
+		if unavailable+1 > allowed {
+			return &BlockedError{
+				Budget:      b.Name,
+				Group:       group,
+				Unavailable: unavailable,
+				Allowed:     allowed,
+			}
+		}
+	}
+
+	return nil
+}
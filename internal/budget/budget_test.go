@@ -0,0 +1,184 @@
+package budget_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nabutabu/crane-oss/internal/budget"
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    budget.Limit
+		wantErr bool
+	}{
+		{in: "3", want: budget.Limit{Count: 3}},
+		{in: "0", want: budget.Limit{}},
+		{in: "25%", want: budget.Limit{Percent: 25}},
+		{in: "-1", wantErr: true},
+		{in: "120%", wantErr: true},
+		{in: "a few", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := budget.ParseLimit(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimit_Allowed(t *testing.T) {
+	tests := []struct {
+		limit budget.Limit
+		total int
+		want  int
+	}{
+		{limit: budget.Limit{Count: 2}, total: 10, want: 2},
+		{limit: budget.Limit{Percent: 10}, total: 10, want: 1},
+		{limit: budget.Limit{Percent: 10}, total: 3, want: 1},
+		{limit: budget.Limit{Percent: 25}, total: 10, want: 3},
+		{limit: budget.Limit{Percent: 10}, total: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.limit.Allowed(tt.total); got != tt.want {
+			t.Errorf("%s.Allowed(%d) = %d, want %d", tt.limit, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	budgets, err := budget.Parse(`[
+		{"name": "per-zone", "zone": "*", "max_unavailable": "10%"},
+		{"name": "web", "role": "web", "max_unavailable": 2}
+	]`)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	want := []budget.Budget{
+		{Name: "per-zone", Zone: budget.Each, MaxUnavailable: budget.Limit{Percent: 10}},
+		{Name: "web", Role: "web", MaxUnavailable: budget.Limit{Count: 2}},
+	}
+	if fmt.Sprint(budgets) != fmt.Sprint(want) {
+		t.Errorf("Parse() = %+v, want %+v", budgets, want)
+	}
+
+	b, err := json.Marshal(budgets[0])
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	if got := string(b); got != `{"name":"per-zone","zone":"*","max_unavailable":"10%"}` {
+		t.Errorf("Marshal() = %s", got)
+	}
+
+	if _, err := budget.Parse(`[{"max_unavailable": "1"}]`); err == nil {
+		t.Errorf("Parse() accepted a budget without a name")
+	}
+}
+
+func host(id, zone string, state api.HostState) *api.Host {
+	return &api.Host{ID: id, Zone: zone, Role: api.Role{Name: "web"}, State: state}
+}
+
+func TestChecker_Check(t *testing.T) {
+	hosts := []*api.Host{
+		host("a1", "a", api.HostReady),
+		host("a2", "a", api.HostReady),
+		host("a3", "a", api.HostDraining),
+		host("a4", "a", api.HostTerminated),
+		host("a5", "a", api.HostProvisioning),
+		host("b1", "b", api.HostReady),
+		host("b2", "b", api.HostReady),
+	}
+
+	tests := []struct {
+		name      string
+		budgets   []budget.Budget
+		host      string
+		disrupted map[string]bool
+		blockedBy string
+	}{
+		{
+			name:    "within budget",
+			budgets: []budget.Budget{{Name: "two", MaxUnavailable: budget.Limit{Count: 2}}},
+			host:    "a1",
+		},
+		{
+			name:      "draining host uses up the budget",
+			budgets:   []budget.Budget{{Name: "one", MaxUnavailable: budget.Limit{Count: 1}}},
+			host:      "b1",
+			blockedBy: "one",
+		},
+		{
+			name:      "per zone",
+			budgets:   []budget.Budget{{Name: "per-zone", Zone: budget.Each, MaxUnavailable: budget.Limit{Count: 1}}},
+			host:      "a1",
+			blockedBy: "per-zone",
+		},
+		{
+			name:    "per zone leaves other zones alone",
+			budgets: []budget.Budget{{Name: "per-zone", Zone: budget.Each, MaxUnavailable: budget.Limit{Count: 1}}},
+			host:    "b1",
+		},
+		{
+			name:      "disrupted hosts count",
+			budgets:   []budget.Budget{{Name: "per-zone", Zone: budget.Each, MaxUnavailable: budget.Limit{Count: 1}}},
+			host:      "b1",
+			disrupted: map[string]bool{"b2": true},
+			blockedBy: "per-zone",
+		},
+		{
+			name:      "percentage ignores terminated and provisioning hosts",
+			budgets:   []budget.Budget{{Name: "zone-a", Zone: "a", MaxUnavailable: budget.Limit{Percent: 50}}},
+			host:      "a1",
+			disrupted: map[string]bool{"a2": true},
+			blockedBy: "zone-a",
+		},
+		{
+			name:    "budget for another role",
+			budgets: []budget.Budget{{Name: "db", Role: "db", MaxUnavailable: budget.Limit{Count: 0}}},
+			host:    "a1",
+		},
+		{
+			name:    "unavailable hosts can always be disrupted",
+			budgets: []budget.Budget{{Name: "none", MaxUnavailable: budget.Limit{Count: 0}}},
+			host:    "a3",
+		},
+	}
+
+	byID := make(map[string]*api.Host)
+	for _, h := range hosts {
+		byID[h.ID] = h
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := budget.NewChecker(tt.budgets).Check(byID[tt.host], hosts, tt.disrupted)
+			if tt.blockedBy == "" {
+				if err != nil {
+					t.Errorf("Check() = %v, want nil", err)
+				}
+				return
+			}
+
+			var blocked *budget.BlockedError
+			if !errors.As(err, &blocked) || blocked.Budget != tt.blockedBy {
+				t.Fatalf("Check() = %v, want blocked by %q", err, tt.blockedBy)
+			}
+			if !errors.Is(err, budget.ErrBudgetExceeded) {
+				t.Errorf("Check() error does not wrap ErrBudgetExceeded")
+			}
+		})
+	}
+}
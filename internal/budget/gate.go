@@ -0,0 +1,58 @@
+package budget
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nabutabu/crane-oss/internal/execute"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+// Gate enforces budgets when workers claim actions. It counts hosts with a
+// running action as disrupted, so two workers claiming actions in the same
+// group at once see each other.
+type Gate struct {
+	checker *Checker
+	hosts   store.HostStore
+	actions execute.ActionStore
+}
+
+var _ execute.Gate = (*Gate)(nil)
+
+func NewGate(checker *Checker, hosts store.HostStore, actions execute.ActionStore) *Gate {
+	return &Gate{
+		checker: checker,
+		hosts:   hosts,
+		actions: actions,
+	}
+}
+
+func (g *Gate) Admit(ctx context.Context, record *execute.ActionRecord) error {
+	host, err := g.hosts.GetByID(ctx, record.HostID)
+	if errors.Is(err, api.ErrNotFound) {
+		// nothing to protect; let the executor fail the action
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	hosts, err := store.ListAll(ctx, g.hosts, store.HostQuery{})
+	if err != nil {
+		return err
+	}
+
+	active, err := g.actions.Active(ctx)
+	if err != nil {
+		return err
+	}
+	disrupted := make(map[string]bool)
+	for _, a := range active {
+		if a.Status == execute.ActionRunning && a.ID != record.ID {
+			disrupted[a.HostID] = true
+		}
+	}
+
+	return g.checker.Check(host, hosts, disrupted)
+}
@@ -0,0 +1,76 @@
+package budget_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nabutabu/crane-oss/internal/budget"
+	"github.com/nabutabu/crane-oss/internal/execute"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+// activeActions serves Active from a fixed list; the gate uses nothing else.
+type activeActions struct {
+	execute.ActionStore
+	active []*execute.ActionRecord
+}
+
+func (a *activeActions) Active(ctx context.Context) ([]*execute.ActionRecord, error) {
+	return a.active, nil
+}
+
+func TestGate_Admit(t *testing.T) {
+	ctx := context.Background()
+	hosts := store.NewMemoryHostStore()
+	for _, h := range []*api.Host{host("a1", "a", api.HostReady), host("a2", "a", api.HostReady)} {
+		if err := hosts.Create(ctx, h); err != nil {
+			t.Fatalf("Create(%s) failed: %v", h.ID, err)
+		}
+	}
+	checker := budget.NewChecker([]budget.Budget{{Name: "one", MaxUnavailable: budget.Limit{Count: 1}}})
+
+	tests := []struct {
+		name    string
+		active  []*execute.ActionRecord
+		record  *execute.ActionRecord
+		wantErr error
+	}{
+		{
+			name:   "nothing else running",
+			active: []*execute.ActionRecord{{ID: 1, HostID: "a1", Status: execute.ActionRunning}},
+			record: &execute.ActionRecord{ID: 1, HostID: "a1"},
+		},
+		{
+			name: "pending actions do not count",
+			active: []*execute.ActionRecord{
+				{ID: 1, HostID: "a1", Status: execute.ActionRunning},
+				{ID: 2, HostID: "a2", Status: execute.ActionPending},
+			},
+			record: &execute.ActionRecord{ID: 1, HostID: "a1"},
+		},
+		{
+			name: "running action elsewhere in the budget",
+			active: []*execute.ActionRecord{
+				{ID: 1, HostID: "a1", Status: execute.ActionRunning},
+				{ID: 2, HostID: "a2", Status: execute.ActionRunning},
+			},
+			record:  &execute.ActionRecord{ID: 1, HostID: "a1"},
+			wantErr: budget.ErrBudgetExceeded,
+		},
+		{
+			name:   "host is gone",
+			record: &execute.ActionRecord{ID: 3, HostID: "missing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gate := budget.NewGate(checker, hosts, &activeActions{active: tt.active})
+			if err := gate.Admit(ctx, tt.record); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Admit() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -12,6 +12,12 @@ const (
 type Action struct {
 	HostID string
 	Type   ActionType
+	// RequestID identifies the API request or reconcile that caused the
+	// action, so that its execution can be traced back to it in the logs.
+	RequestID string
+	// TraceParent is the W3C traceparent of the span that enqueued the
+	// action. Workers continue its trace when they run the action.
+	TraceParent string
 }
 
 type ActionStatus string
@@ -21,14 +27,25 @@ const (
 	ActionRunning ActionStatus = "running"
 	ActionDone    ActionStatus = "done"
 	ActionFailed  ActionStatus = "failed"
+	// ActionDead marks an action that kept failing until its retry policy
+	// gave up on it.
+	ActionDead ActionStatus = "dead"
 )
 
 type ActionRecord struct {
-	ID        int
-	HostID    string
-	Type      ActionType
-	Status    ActionStatus
-	Attempts  int
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          int
+	HostID      string
+	Type        ActionType
+	Status      ActionStatus
+	Attempts    int
+	LastError   string
+	NotBefore   time.Time
+	RequestID   string
+	TraceParent string
+	// WorkerID and LeaseExpiresAt identify the worker a running action is
+	// leased to and until when.
+	WorkerID       string
+	LeaseExpiresAt time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
 }
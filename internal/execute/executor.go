@@ -2,13 +2,371 @@ package execute
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
 	"github.com/nabutabu/crane-oss/internal/hostcatalog/service"
+	"github.com/nabutabu/crane-oss/internal/provider"
+	"github.com/nabutabu/crane-oss/internal/tracing"
+	"github.com/nabutabu/crane-oss/pkg/api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type DefaultExecutor struct {
-	catalog *service.HostCatalogService
-}
+// executorActor is recorded in the host history for transitions made while
+// executing actions.
+const executorActor = "crane/executor"
+
+// maxTerminateAttempts bounds how often terminate retries a transition that
+// lost a race with another change to the host.
+const maxTerminateAttempts = 3
+
+// maxReplacements bounds how many replacements of a host may fail before
+// replace gives up on it.
+const maxReplacements = 5
+
+var (
+	ErrUnsupportedAction = errors.New("unsupported action")
+	ErrReplacementFailed = errors.New("replacement host did not become ready")
+)
 
 type Executor interface {
 	Execute(ctx context.Context, action *Action) error
 }
+
+type ExecutorConfig struct {
+	// DrainPeriod is how long a host stays DRAINING before it is
+	// terminated, giving workloads time to move off it.
+	DrainPeriod time.Duration
+	// ReadyTimeout bounds how long a replace waits for the new host, or
+	// the instance backing it, to become ready.
+	ReadyTimeout time.Duration
+	// PollInterval is how often the catalog is polled while waiting.
+	PollInterval time.Duration
+}
+
+// DefaultExecutor carries out actions by driving hosts through the catalog
+// and, for hosts with a Provider, creating and deleting their instances.
+// Both actions are idempotent, so an action that is retried after a crash
+// picks up where the previous attempt left off.
+type DefaultExecutor struct {
+	catalog   *service.HostCatalogService
+	providers *provider.Registry
+	cfg       ExecutorConfig
+}
+
+func NewDefaultExecutor(catalog *service.HostCatalogService, providers *provider.Registry, cfg ExecutorConfig) *DefaultExecutor {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+
+	return &DefaultExecutor{
+		catalog:   catalog,
+		providers: providers,
+		cfg:       cfg,
+	}
+}
+
+func (e *DefaultExecutor) Execute(ctx context.Context, action *Action) (err error) {
+	ctx, span := tracer.Start(ctx, "Executor.Execute", trace.WithAttributes(
+		tracing.KeyHostID.String(action.HostID),
+		attribute.String("type", string(action.Type)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	switch action.Type {
+	case ActionDrainHost:
+		return e.drain(ctx, action.HostID, "drain_host action")
+	case ActionReplaceHost:
+		return e.replace(ctx, action.HostID)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedAction, action.Type)
+	}
+}
+
+// drain moves a host READY -> DRAINING, waits for the drain period and then
+// deletes its instance and terminates it. Hosts that are already DRAINING
+// resume the drain, and UNHEALTHY hosts, which serve no traffic, are
+// terminated straight away.
+func (e *DefaultExecutor) drain(ctx context.Context, id string, reason string) (err error) {
+	ctx, span := tracer.Start(ctx, "Executor.drain", trace.WithAttributes(tracing.KeyHostID.String(id)))
+	defer func() { tracing.End(span, err) }()
+
+	host, err := e.catalog.GetHost(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	switch host.State {
+	case api.HostTerminated:
+		return nil
+	case api.HostProvisioning:
+		return fmt.Errorf("%w: %s -> %s", api.ErrInvalidTransition, host.State, api.HostDraining)
+	case api.HostReady:
+		host, err = e.transition(ctx, host, api.HostDraining, reason)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case api.HostDraining:
+		span.AddEvent("drain period", trace.WithAttributes(attribute.String("duration", e.cfg.DrainPeriod.String())))
+		if err := sleep(ctx, e.cfg.DrainPeriod); err != nil {
+			return err
+		}
+	}
+
+	if err := e.deleteInstance(ctx, host); err != nil {
+		return err
+	}
+
+	return e.terminate(ctx, id, reason)
+}
+
+// terminate moves a host to TERMINATED. Health reports bump the version of
+// a host while it drains, so the transition is made against a fresh read
+// and retried if the host changes again underneath it.
+func (e *DefaultExecutor) terminate(ctx context.Context, id string, reason string) error {
+	var err error
+	for range maxTerminateAttempts {
+		var host *api.Host
+		host, err = e.catalog.GetHost(ctx, id)
+		if err != nil {
+			return err
+		}
+		if host.State == api.HostTerminated {
+			return nil
+		}
+
+		_, err = e.transition(ctx, host, api.HostTerminated, reason)
+		if !errors.Is(err, api.ErrConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+func (e *DefaultExecutor) deleteInstance(ctx context.Context, host *api.Host) (err error) {
+	if host.Provider == "" || host.ProviderID == "" {
+		return nil
+	}
+
+	ctx, span := tracer.Start(ctx, "Executor.deleteInstance", trace.WithAttributes(
+		tracing.KeyHostID.String(host.ID),
+		attribute.String("provider", host.Provider),
+		attribute.String("provider_id", host.ProviderID),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	p, err := e.providers.Get(host.Provider)
+	if err != nil {
+		return err
+	}
+
+	err = p.DeleteInstance(ctx, host.ProviderID)
+	if err != nil && !errors.Is(err, provider.ErrInstanceNotFound) {
+		return fmt.Errorf("delete instance %s of %s: %w", host.ProviderID, host.ID, err)
+	}
+	return nil
+}
+
+// replace provisions a new host with the same role, zone, fleet and image,
+// waits for it to become READY and then drains the old host. The replacement
+// has an ID derived from the old host, so a retried replace reuses the host
+// registered by the previous attempt instead of registering another. A
+// replacement that failed is drained and superseded by a fresh one.
+//
+// Hosts with a Provider are replaced by booting an instance first and
+// registering the replacement once it is running; the executor then marks it
+// READY itself. Hosts without one are registered straight away and left for
+// whoever provisions them out of band to mark READY.
+func (e *DefaultExecutor) replace(ctx context.Context, id string) error {
+	old, err := e.catalog.GetHost(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if old.State == api.HostTerminated {
+		return nil
+	}
+
+	replacement, err := e.replacement(ctx, old)
+	if err != nil {
+		return fmt.Errorf("replacement for %s: %w", old.ID, err)
+	}
+
+	if replacement.State == api.HostProvisioning && replacement.ProviderID != "" {
+		if _, err := e.transition(ctx, replacement, api.HostReady, "instance "+replacement.ProviderID+" is running"); err != nil {
+			return err
+		}
+	}
+
+	if err := e.waitReady(ctx, replacement.ID); err != nil {
+		return err
+	}
+
+	return e.drain(ctx, old.ID, "replaced by "+replacement.ID)
+}
+
+// replacement returns the current replacement of old, provisioning one if
+// there is none. Replacements are numbered; one that became UNHEALTHY or was
+// taken out of service is drained, and the next number is tried.
+func (e *DefaultExecutor) replacement(ctx context.Context, old *api.Host) (*api.Host, error) {
+	for n := range maxReplacements {
+		id := replacementID(old.ID, n)
+		host, err := e.catalog.GetHost(ctx, id)
+		if errors.Is(err, api.ErrNotFound) {
+			return e.provision(ctx, old, id)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch host.State {
+		case api.HostProvisioning, api.HostReady:
+			return host, nil
+		case api.HostUnhealthy, api.HostDraining:
+			if err := e.drain(ctx, id, "replacement for "+old.ID+" failed"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: gave up after %d replacements", ErrReplacementFailed, maxReplacements)
+}
+
+func (e *DefaultExecutor) provision(ctx context.Context, old *api.Host, id string) (_ *api.Host, err error) {
+	ctx, span := tracer.Start(ctx, "Executor.provision", trace.WithAttributes(tracing.KeyHostID.String(id)))
+	defer func() { tracing.End(span, err) }()
+
+	host := &api.Host{
+		ID:       id,
+		Provider: old.Provider,
+		Role:     old.Role,
+		Zone:     old.Zone,
+		Fleet:    old.Fleet,
+		ImageID:  old.ImageID,
+		Capacity: old.Capacity,
+	}
+
+	if old.Provider != "" {
+		p, err := e.providers.Get(old.Provider)
+		if err != nil {
+			return nil, err
+		}
+
+		inst, err := e.boot(ctx, p, provider.InstanceSpec{
+			HostID:   host.ID,
+			Role:     host.Role.Name,
+			Zone:     host.Zone,
+			Fleet:    host.Fleet.Name,
+			ImageID:  host.ImageID,
+			Capacity: host.Capacity,
+		})
+		if err != nil {
+			return nil, err
+		}
+		host.ProviderID = inst.ID
+		host.HostName = inst.Hostname
+	}
+
+	return e.catalog.RegisterHost(ctx, host)
+}
+
+// boot creates an instance and waits for it to be running. An instance that
+// fails to boot is deleted so that the next attempt starts a fresh one.
+func (e *DefaultExecutor) boot(ctx context.Context, p provider.Provider, spec provider.InstanceSpec) (_ *provider.Instance, err error) {
+	ctx, span := tracer.Start(ctx, "Executor.boot", trace.WithAttributes(tracing.KeyHostID.String(spec.HostID)))
+	defer func() { tracing.End(span, err) }()
+
+	inst, err := p.CreateInstance(ctx, spec)
+	if err != nil {
+		return nil, fmt.Errorf("create instance: %w", err)
+	}
+	span.SetAttributes(attribute.String("provider_id", inst.ID))
+
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.ReadyTimeout)
+	defer cancel()
+
+	for {
+		switch inst.State {
+		case provider.InstanceRunning:
+			return inst, nil
+		case provider.InstancePending:
+		default:
+			err := p.DeleteInstance(context.WithoutCancel(ctx), inst.ID)
+			if err != nil && !errors.Is(err, provider.ErrInstanceNotFound) {
+				return nil, fmt.Errorf("delete instance %s: %w", inst.ID, err)
+			}
+			return nil, fmt.Errorf("%w: instance %s is %s", ErrReplacementFailed, inst.ID, inst.State)
+		}
+
+		if err := sleep(ctx, e.cfg.PollInterval); err != nil {
+			return nil, fmt.Errorf("%w: instance %s still %s: %w", ErrReplacementFailed, inst.ID, inst.State, err)
+		}
+
+		inst, err = p.DescribeInstance(ctx, inst.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (e *DefaultExecutor) waitReady(ctx context.Context, id string) (err error) {
+	ctx, span := tracer.Start(ctx, "Executor.waitReady", trace.WithAttributes(tracing.KeyHostID.String(id)))
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.ReadyTimeout)
+	defer cancel()
+
+	for {
+		host, err := e.catalog.GetHost(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		switch host.State {
+		case api.HostReady:
+			return nil
+		case api.HostProvisioning:
+		default:
+			return fmt.Errorf("%w: %s is %s", ErrReplacementFailed, id, host.State)
+		}
+
+		if err := sleep(ctx, e.cfg.PollInterval); err != nil {
+			return fmt.Errorf("%w: %s still %s: %w", ErrReplacementFailed, id, host.State, err)
+		}
+	}
+}
+
+func (e *DefaultExecutor) transition(ctx context.Context, host *api.Host, to api.HostState, reason string) (*api.Host, error) {
+	return e.catalog.TransitionState(ctx, host.ID, string(to), host.Version, api.ChangeInfo{
+		Actor:  executorActor,
+		Reason: reason,
+	})
+}
+
+// replacementID returns the ID of the nth replacement of host id.
+func replacementID(id string, n int) string {
+	key := id + "/replacement"
+	if n > 0 {
+		key += "/" + strconv.Itoa(n)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "host-" + hex.EncodeToString(sum[:8])
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
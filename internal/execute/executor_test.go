@@ -0,0 +1,360 @@
+package execute_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/execute"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/service"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/internal/provider"
+	"github.com/nabutabu/crane-oss/internal/provider/fake"
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+func newExecutor(t *testing.T, providers *provider.Registry, cfg execute.ExecutorConfig, hosts ...*api.Host) (*execute.DefaultExecutor, *service.HostCatalogService) {
+	t.Helper()
+
+	s := store.NewMemoryHostStore()
+	for _, h := range hosts {
+		if err := s.Create(context.Background(), h); err != nil {
+			t.Fatalf("Create(%s) failed: %v", h.ID, err)
+		}
+	}
+	catalog := service.NewHostCatalogService(s)
+	return execute.NewDefaultExecutor(catalog, providers, cfg), catalog
+}
+
+func TestDefaultExecutor_Drain(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    api.HostState
+		wantErr error
+	}{
+		{name: "ready", from: api.HostReady},
+		{name: "draining resumes", from: api.HostDraining},
+		{name: "unhealthy terminates directly", from: api.HostUnhealthy},
+		{name: "terminated is a no-op", from: api.HostTerminated},
+		{name: "provisioning is rejected", from: api.HostProvisioning, wantErr: api.ErrInvalidTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			executor, catalog := newExecutor(t, provider.NewRegistry(), execute.ExecutorConfig{}, &api.Host{ID: "host-1", State: tt.from})
+
+			err := executor.Execute(ctx, &execute.Action{HostID: "host-1", Type: execute.ActionDrainHost})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Execute() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			host, err := catalog.GetHost(ctx, "host-1")
+			if err != nil {
+				t.Fatalf("GetHost() failed: %v", err)
+			}
+			if host.State != api.HostTerminated {
+				t.Errorf("state = %s, want %s", host.State, api.HostTerminated)
+			}
+		})
+	}
+}
+
+func TestDefaultExecutor_DrainWaitsForDrainPeriod(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	executor, catalog := newExecutor(t, provider.NewRegistry(), execute.ExecutorConfig{DrainPeriod: time.Hour}, &api.Host{ID: "host-1", State: api.HostReady})
+
+	err := executor.Execute(ctx, &execute.Action{HostID: "host-1", Type: execute.ActionDrainHost})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Execute() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	host, err := catalog.GetHost(context.Background(), "host-1")
+	if err != nil {
+		t.Fatalf("GetHost() failed: %v", err)
+	}
+	if host.State != api.HostDraining {
+		t.Errorf("state = %s, want %s", host.State, api.HostDraining)
+	}
+}
+
+func TestDefaultExecutor_DrainSurvivesHealthReports(t *testing.T) {
+	ctx := context.Background()
+	executor, catalog := newExecutor(t, provider.NewRegistry(), execute.ExecutorConfig{DrainPeriod: 50 * time.Millisecond}, &api.Host{ID: "host-1", State: api.HostReady})
+
+	// report health while the host drains, which bumps its version
+	reported := make(chan error, 1)
+	go func() {
+		for {
+			host, err := catalog.GetHost(ctx, "host-1")
+			if err == nil && host.State == api.HostDraining {
+				reported <- catalog.TransitionHealth(ctx, "host-1", string(api.HostHealthHealthy), api.ChangeInfo{Actor: "agent"})
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	if err := executor.Execute(ctx, &execute.Action{HostID: "host-1", Type: execute.ActionDrainHost}); err != nil {
+		t.Fatalf("Execute() failed: %v", err)
+	}
+	if err := <-reported; err != nil {
+		t.Fatalf("TransitionHealth() failed: %v", err)
+	}
+
+	host, err := catalog.GetHost(ctx, "host-1")
+	if err != nil {
+		t.Fatalf("GetHost() failed: %v", err)
+	}
+	if host.State != api.HostTerminated {
+		t.Errorf("state = %s, want %s", host.State, api.HostTerminated)
+	}
+}
+
+func TestDefaultExecutor_Replace(t *testing.T) {
+	ctx := context.Background()
+	old := &api.Host{
+		ID:      "host-1",
+		Role:    api.Role{Name: "web"},
+		Zone:    "us-east-1a",
+		Fleet:   api.Fleet{Name: "edge"},
+		ImageID: "img-1",
+		State:   api.HostUnhealthy,
+	}
+	executor, catalog := newExecutor(t, provider.NewRegistry(), execute.ExecutorConfig{
+		ReadyTimeout: time.Second,
+		PollInterval: time.Millisecond,
+	}, old)
+
+	// play the part of the provisioner: mark the replacement READY once it
+	// has been registered
+	go func() {
+		for {
+			page, err := catalog.ListHosts(ctx, store.HostQuery{States: []api.HostState{api.HostProvisioning}})
+			if err == nil && len(page.Hosts) == 1 {
+				catalog.TransitionState(ctx, page.Hosts[0].ID, string(api.HostReady), 0, api.ChangeInfo{})
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	if err := executor.Execute(ctx, &execute.Action{HostID: "host-1", Type: execute.ActionReplaceHost}); err != nil {
+		t.Fatalf("Execute() failed: %v", err)
+	}
+
+	page, err := catalog.ListHosts(ctx, store.HostQuery{})
+	if err != nil {
+		t.Fatalf("ListHosts() failed: %v", err)
+	}
+	if len(page.Hosts) != 2 {
+		t.Fatalf("got %d hosts, want 2", len(page.Hosts))
+	}
+
+	for _, host := range page.Hosts {
+		if host.ID == old.ID {
+			if host.State != api.HostTerminated {
+				t.Errorf("old host state = %s, want %s", host.State, api.HostTerminated)
+			}
+			continue
+		}
+		if host.State != api.HostReady {
+			t.Errorf("replacement state = %s, want %s", host.State, api.HostReady)
+		}
+		if host.Role != old.Role || host.Zone != old.Zone || host.Fleet != old.Fleet || host.ImageID != old.ImageID {
+			t.Errorf("replacement = %+v, want role/zone/fleet/image of %+v", host, old)
+		}
+	}
+}
+
+func TestDefaultExecutor_ReplaceRetryReusesReplacement(t *testing.T) {
+	ctx := context.Background()
+	executor, catalog := newExecutor(t, provider.NewRegistry(), execute.ExecutorConfig{
+		ReadyTimeout: 10 * time.Millisecond,
+		PollInterval: time.Millisecond,
+	}, &api.Host{ID: "host-1", Role: api.Role{Name: "web"}, Zone: "us-east-1a", ImageID: "img-1", State: api.HostReady})
+
+	action := &execute.Action{HostID: "host-1", Type: execute.ActionReplaceHost}
+	for range 2 {
+		if err := executor.Execute(ctx, action); !errors.Is(err, execute.ErrReplacementFailed) {
+			t.Fatalf("Execute() error = %v, want %v", err, execute.ErrReplacementFailed)
+		}
+	}
+
+	page, err := catalog.ListHosts(ctx, store.HostQuery{})
+	if err != nil {
+		t.Fatalf("ListHosts() failed: %v", err)
+	}
+	if len(page.Hosts) != 2 {
+		t.Errorf("got %d hosts, want 2", len(page.Hosts))
+	}
+}
+
+func TestDefaultExecutor_ReplaceSupersedesFailedReplacement(t *testing.T) {
+	ctx := context.Background()
+	executor, catalog := newExecutor(t, provider.NewRegistry(), execute.ExecutorConfig{
+		ReadyTimeout: 10 * time.Millisecond,
+		PollInterval: time.Millisecond,
+	}, &api.Host{ID: "host-1", Role: api.Role{Name: "web"}, Zone: "us-east-1a", ImageID: "img-1", State: api.HostUnhealthy})
+	action := &execute.Action{HostID: "host-1", Type: execute.ActionReplaceHost}
+
+	if err := executor.Execute(ctx, action); !errors.Is(err, execute.ErrReplacementFailed) {
+		t.Fatalf("Execute() error = %v, want %v", err, execute.ErrReplacementFailed)
+	}
+	page, err := catalog.ListHosts(ctx, store.HostQuery{States: []api.HostState{api.HostProvisioning}})
+	if err != nil || len(page.Hosts) != 1 {
+		t.Fatalf("ListHosts() = %v, %v; want the first replacement", page, err)
+	}
+	failed := page.Hosts[0].ID
+
+	// the first replacement comes up, then fails
+	for _, to := range []api.HostState{api.HostReady, api.HostUnhealthy} {
+		if _, err := catalog.TransitionState(ctx, failed, string(to), 0, api.ChangeInfo{}); err != nil {
+			t.Fatalf("TransitionState(%s) failed: %v", to, err)
+		}
+	}
+
+	go func() {
+		for {
+			page, err := catalog.ListHosts(ctx, store.HostQuery{States: []api.HostState{api.HostProvisioning}})
+			if err == nil && len(page.Hosts) == 1 {
+				catalog.TransitionState(ctx, page.Hosts[0].ID, string(api.HostReady), 0, api.ChangeInfo{})
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	if err := executor.Execute(ctx, action); err != nil {
+		t.Fatalf("Execute() failed: %v", err)
+	}
+
+	page, err = catalog.ListHosts(ctx, store.HostQuery{})
+	if err != nil {
+		t.Fatalf("ListHosts() failed: %v", err)
+	}
+	states := make(map[string]api.HostState)
+	for _, host := range page.Hosts {
+		states[host.ID] = host.State
+	}
+	if len(states) != 3 || states["host-1"] != api.HostTerminated || states[failed] != api.HostTerminated {
+		t.Errorf("hosts = %v, want host-1 and %s terminated and a new replacement", states, failed)
+	}
+}
+
+func TestDefaultExecutor_UnsupportedAction(t *testing.T) {
+	executor, _ := newExecutor(t, provider.NewRegistry(), execute.ExecutorConfig{})
+
+	err := executor.Execute(context.Background(), &execute.Action{HostID: "host-1", Type: "reboot_host"})
+	if !errors.Is(err, execute.ErrUnsupportedAction) {
+		t.Errorf("Execute() error = %v, want %v", err, execute.ErrUnsupportedAction)
+	}
+}
+
+func newFakeProvider(t *testing.T, cfg fake.Config) (*provider.Registry, *fake.Provider, *api.Host) {
+	t.Helper()
+
+	p := fake.New(cfg)
+	inst, err := p.CreateInstance(context.Background(), provider.InstanceSpec{HostID: "host-1"})
+	if err != nil {
+		t.Fatalf("CreateInstance() failed: %v", err)
+	}
+
+	providers := provider.NewRegistry()
+	providers.Register(fake.Name, p)
+	return providers, p, &api.Host{
+		ID:         "host-1",
+		Provider:   fake.Name,
+		ProviderID: inst.ID,
+		Role:       api.Role{Name: "web"},
+		Zone:       "us-east-1a",
+		ImageID:    "img-1",
+		State:      api.HostReady,
+	}
+}
+
+func TestDefaultExecutor_ReplaceWithProvider(t *testing.T) {
+	ctx := context.Background()
+	providers, p, old := newFakeProvider(t, fake.Config{})
+	executor, catalog := newExecutor(t, providers, execute.ExecutorConfig{
+		ReadyTimeout: time.Second,
+		PollInterval: time.Millisecond,
+	}, old)
+
+	if err := executor.Execute(ctx, &execute.Action{HostID: "host-1", Type: execute.ActionReplaceHost}); err != nil {
+		t.Fatalf("Execute() failed: %v", err)
+	}
+
+	page, err := catalog.ListHosts(ctx, store.HostQuery{States: []api.HostState{api.HostReady}})
+	if err != nil {
+		t.Fatalf("ListHosts() failed: %v", err)
+	}
+	if len(page.Hosts) != 1 {
+		t.Fatalf("got %d READY hosts, want 1", len(page.Hosts))
+	}
+
+	replacement := page.Hosts[0]
+	inst, err := p.DescribeInstance(ctx, replacement.ProviderID)
+	if err != nil {
+		t.Fatalf("DescribeInstance(%s) failed: %v", replacement.ProviderID, err)
+	}
+	if inst.State != provider.InstanceRunning || inst.HostID != replacement.ID {
+		t.Errorf("replacement instance = %+v, want running instance of %s", inst, replacement.ID)
+	}
+
+	inst, err = p.DescribeInstance(ctx, old.ProviderID)
+	if err != nil {
+		t.Fatalf("DescribeInstance(%s) failed: %v", old.ProviderID, err)
+	}
+	if inst.State != provider.InstanceTerminated {
+		t.Errorf("old instance state = %s, want %s", inst.State, provider.InstanceTerminated)
+	}
+}
+
+func TestDefaultExecutor_ReplaceBootFailure(t *testing.T) {
+	ctx := context.Background()
+	providers, p, old := newFakeProvider(t, fake.Config{FailureRate: 1})
+	executor, catalog := newExecutor(t, providers, execute.ExecutorConfig{
+		ReadyTimeout: time.Second,
+		PollInterval: time.Millisecond,
+	}, old)
+
+	err := executor.Execute(ctx, &execute.Action{HostID: "host-1", Type: execute.ActionReplaceHost})
+	if !errors.Is(err, execute.ErrReplacementFailed) {
+		t.Fatalf("Execute() error = %v, want %v", err, execute.ErrReplacementFailed)
+	}
+
+	page, err := catalog.ListHosts(ctx, store.HostQuery{})
+	if err != nil {
+		t.Fatalf("ListHosts() failed: %v", err)
+	}
+	if len(page.Hosts) != 1 || page.Hosts[0].State != api.HostReady {
+		t.Errorf("hosts = %+v, want only the untouched old host", page.Hosts)
+	}
+
+	instances, err := p.ListInstances(ctx)
+	if err != nil {
+		t.Fatalf("ListInstances() failed: %v", err)
+	}
+	for _, inst := range instances {
+		if inst.ID != old.ProviderID && inst.State != provider.InstanceTerminated {
+			t.Errorf("failed instance %s left in state %s", inst.ID, inst.State)
+		}
+	}
+}
+
+func TestDefaultExecutor_UnknownProvider(t *testing.T) {
+	_, _, old := newFakeProvider(t, fake.Config{})
+	executor, _ := newExecutor(t, provider.NewRegistry(), execute.ExecutorConfig{}, old)
+
+	err := executor.Execute(context.Background(), &execute.Action{HostID: "host-1", Type: execute.ActionDrainHost})
+	if !errors.Is(err, provider.ErrUnknownProvider) {
+		t.Errorf("Execute() error = %v, want %v", err, provider.ErrUnknownProvider)
+	}
+}
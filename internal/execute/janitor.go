@@ -0,0 +1,56 @@
+package execute
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Janitor returns actions whose worker stopped heartbeating, because it
+// crashed or its process was killed mid-deploy, to the queue.
+type Janitor struct {
+	store    ActionStore
+	interval time.Duration
+	// Logger defaults to slog.Default.
+	Logger *slog.Logger
+}
+
+func NewJanitor(store ActionStore, interval time.Duration) *Janitor {
+	return &Janitor{
+		store:    store,
+		interval: interval,
+	}
+}
+
+func (j *Janitor) logger() *slog.Logger {
+	if j.Logger == nil {
+		return slog.Default()
+	}
+	return j.Logger
+}
+
+// Run reclaims expired leases every interval until ctx is cancelled.
+func (j *Janitor) Run(ctx context.Context) {
+	logger := j.logger()
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := j.store.ReclaimExpired(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.ErrorContext(ctx, "janitor: reclaim expired actions", "error", err)
+			}
+			continue
+		}
+		if n > 0 {
+			logger.InfoContext(ctx, "janitor: returned actions with expired leases to the queue", "actions", n)
+		}
+	}
+}
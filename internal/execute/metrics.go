@@ -0,0 +1,25 @@
+package execute
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	actionsClaimed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crane_actions_claimed_total",
+		Help: "Actions claimed by workers, by type.",
+	}, []string{"type"})
+	actionsDone = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crane_actions_done_total",
+		Help: "Actions completed successfully, by type.",
+	}, []string{"type"})
+	actionsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crane_actions_failed_total",
+		Help: "Failed action attempts, by type and what became of the action: retry, dead or failed.",
+	}, []string{"type", "outcome"})
+	actionsBlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crane_actions_blocked_total",
+		Help: "Claimed actions returned to the queue because the gate did not admit them, by type.",
+	}, []string{"type"})
+)
@@ -3,78 +3,280 @@ package execute
 import (
 	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/logging"
 )
 
+// maxEnqueueAttempts bounds how often Enqueue retries when a host's active
+// action keeps finishing underneath it.
+const maxEnqueueAttempts = 3
+
 type PostgresActionStore struct {
-	DB sql.DB
+	DB *sql.DB
+	// Logger defaults to slog.Default.
+	Logger *slog.Logger
+}
+
+func NewPostgresActionStore(DB *sql.DB) *PostgresActionStore {
+	return &PostgresActionStore{
+		DB: DB,
+	}
 }
 
-func (store *PostgresActionStore) Enqueue(ctx context.Context, action *Action) error {
-	log.Println("/PostgresActionStore/Enqueue")
+func (store *PostgresActionStore) logger() *slog.Logger {
+	if store.Logger == nil {
+		return slog.Default()
+	}
+	return store.Logger
+}
 
-	query := `
-        INSERT INTO actions (hostid, status, attempts, createdat, type)
-        VALUES ($1, 'pending', 0, NOW(), $2)
-				RETURNING id
+func (store *PostgresActionStore) Enqueue(ctx context.Context, action *Action) (*ActionRecord, error) {
+	insert := `
+        INSERT INTO actions (hostid, status, attempts, createdat, type, requestid, traceparent)
+        VALUES ($1, 'pending', 0, NOW(), $2, $3, $4)
+        ON CONFLICT (hostid) WHERE status IN ('pending', 'running') DO NOTHING
+        RETURNING id, status, attempts, createdat
+    `
+	active := `
+        SELECT id, type, status, attempts, requestid, traceparent, createdat
+        FROM actions
+        WHERE hostid = $1 AND status IN ('pending', 'running')
     `
 
-	var id int
-	err := store.DB.QueryRow(query, action.HostID, action.Type).Scan(&id)
-	if err != nil {
-		return err
+	// the active action can finish between the insert and the select, in
+	// which case the insert is worth another try
+	for range maxEnqueueAttempts {
+		record := ActionRecord{
+			HostID:      action.HostID,
+			Type:        action.Type,
+			RequestID:   action.RequestID,
+			TraceParent: action.TraceParent,
+		}
+		err := store.DB.QueryRowContext(ctx, insert, action.HostID, action.Type, action.RequestID, action.TraceParent).Scan(
+			&record.ID,
+			&record.Status,
+			&record.Attempts,
+			&record.CreatedAt,
+		)
+		if err == nil {
+			store.logger().DebugContext(ctx, "action enqueued",
+				logging.KeyActionID, record.ID,
+				logging.KeyHostID, record.HostID,
+				"type", record.Type,
+			)
+			return &record, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		err = store.DB.QueryRowContext(ctx, active, action.HostID).Scan(
+			&record.ID,
+			&record.Type,
+			&record.Status,
+			&record.Attempts,
+			&record.RequestID,
+			&record.TraceParent,
+			&record.CreatedAt,
+		)
+		if err == nil {
+			return &record, ErrAlreadyQueued
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
 	}
-	log.Printf("New task id: %d", id)
 
-	return nil
+	return nil, fmt.Errorf("enqueue %s for %s: active action kept changing", action.Type, action.HostID)
 }
 
-func (store *PostgresActionStore) Next(ctx context.Context) (*ActionRecord, error) {
-	log.Println("/PostgresActionStore/Next")
+func (store *PostgresActionStore) Next(ctx context.Context, workerID string, lease time.Duration) (*ActionRecord, error) {
 	var record ActionRecord
 	query := `
         UPDATE actions
-        SET status = 'running', updatedat = NOW(), attempts = attempts + 1
+        SET status = 'running', updatedat = NOW(), attempts = attempts + 1,
+            workerid = $1, leaseexpiresat = NOW() + $2 * INTERVAL '1 second'
         WHERE id = (
             SELECT id
             FROM actions
-            WHERE status = 'pending'
+            WHERE status = 'pending' AND notbefore <= NOW()
             ORDER BY createdat
             LIMIT 1
             FOR UPDATE SKIP LOCKED
         )
-        RETURNING id, hostid, attempts, type
+        RETURNING id, hostid, attempts, type, requestid, traceparent, leaseexpiresat
     `
-	err := store.DB.QueryRow(query).Scan(
+	err := store.DB.QueryRowContext(ctx, query, workerID, lease.Seconds()).Scan(
 		&record.ID,
 		&record.HostID,
 		&record.Attempts,
 		&record.Type,
+		&record.RequestID,
+		&record.TraceParent,
+		&record.LeaseExpiresAt,
 	)
 	if err != nil {
 		return nil, err
 	}
 
 	record.Status = ActionRunning
+	record.WorkerID = workerID
+	store.logger().DebugContext(ctx, "action claimed",
+		logging.KeyActionID, record.ID,
+		logging.KeyHostID, record.HostID,
+		"worker_id", workerID,
+	)
 	return &record, nil
 }
 
-func (store *PostgresActionStore) MarkDone(ctx context.Context, id int) error {
-	log.Println("/PostgresActionStore/MarkDone")
-	// Mark it done
-	_, err := store.DB.Exec("UPDATE actions SET status='done', updatedat=NOW() WHERE id=$1", id)
+func (store *PostgresActionStore) Heartbeat(ctx context.Context, id int, workerID string, lease time.Duration) error {
+	// Extend the lease, unless it has been taken away
+	return store.ack(ctx, `
+        UPDATE actions
+        SET leaseexpiresat = NOW() + $1 * INTERVAL '1 second', updatedat = NOW()
+        WHERE id = $2 AND workerid = $3 AND status = 'running'
+    `, lease.Seconds(), id, workerID)
+}
+
+func (store *PostgresActionStore) ReclaimExpired(ctx context.Context) (int, error) {
+	// Put actions whose worker went away back in the queue
+	res, err := store.DB.ExecContext(ctx, `
+        UPDATE actions
+        SET status = 'pending', lasterror = $1, notbefore = NOW(), workerid = '', leaseexpiresat = NULL, updatedat = NOW()
+        WHERE status = 'running' AND leaseexpiresat < NOW()
+    `, ErrLeaseExpired.Error())
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
 }
 
-func (store *PostgresActionStore) MarkFailed(ctx context.Context, id int) error {
-	log.Println("/PostgresActionStore/MarkFailed")
+func (store *PostgresActionStore) MarkDone(ctx context.Context, id int, workerID string) error {
+	// Mark it done
+	return store.ack(ctx, "UPDATE actions SET status='done', updatedat=NOW() WHERE id=$1 AND workerid=$2 AND status='running'", id, workerID)
+}
+
+func (store *PostgresActionStore) MarkFailed(ctx context.Context, id int, workerID string, err error) error {
 	// Mark it failed
-	_, err := store.DB.Exec("UPDATE actions SET status='failed', updatedat=NOW() WHERE id=$1", id)
+	return store.ack(ctx, "UPDATE actions SET status='failed', lasterror=$1, updatedat=NOW() WHERE id=$2 AND workerid=$3 AND status='running'", err.Error(), id, workerID)
+}
+
+func (store *PostgresActionStore) MarkRetry(ctx context.Context, id int, workerID string, err error, notBefore time.Time) error {
+	// Put it back in the queue
+	return store.ack(ctx, `
+        UPDATE actions
+        SET status='pending', lasterror=$1, notbefore=$2, workerid='', leaseexpiresat=NULL, updatedat=NOW()
+        WHERE id=$3 AND workerid=$4 AND status='running'
+    `, err.Error(), notBefore, id, workerID)
+}
+
+func (store *PostgresActionStore) MarkDead(ctx context.Context, id int, workerID string, err error) error {
+	// Give up on it
+	return store.ack(ctx, "UPDATE actions SET status='dead', lasterror=$1, updatedat=NOW() WHERE id=$2 AND workerid=$3 AND status='running'", err.Error(), id, workerID)
+}
+
+func (store *PostgresActionStore) MarkBlocked(ctx context.Context, id int, workerID string, err error, notBefore time.Time) error {
+	// Put it back in the queue without spending an attempt
+	return store.ack(ctx, `
+        UPDATE actions
+        SET status = 'pending', attempts = attempts - 1, lasterror = $1, notbefore = $2,
+            workerid = '', leaseexpiresat = NULL, updatedat = NOW()
+        WHERE id = $3 AND workerid = $4 AND status = 'running'
+    `, err.Error(), notBefore, id, workerID)
+}
+
+// ack runs an update of a running action that only applies while the
+// action is leased to the worker making it, and returns ErrLeaseLost if it
+// was not.
+func (store *PostgresActionStore) ack(ctx context.Context, query string, args ...any) error {
+	res, err := store.DB.ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
 	return nil
 }
+
+func (store *PostgresActionStore) Active(ctx context.Context) ([]*ActionRecord, error) {
+	rows, err := store.DB.QueryContext(ctx, `
+        SELECT id, hostid, type, status, attempts, lasterror, notbefore, workerid, createdat, updatedat
+        FROM actions
+        WHERE status IN ('pending', 'running')
+        ORDER BY createdat, id
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*ActionRecord
+	for rows.Next() {
+		var record ActionRecord
+		if err := rows.Scan(
+			&record.ID,
+			&record.HostID,
+			&record.Type,
+			&record.Status,
+			&record.Attempts,
+			&record.LastError,
+			&record.NotBefore,
+			&record.WorkerID,
+			&record.CreatedAt,
+			&record.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		records = append(records, &record)
+	}
+	return records, rows.Err()
+}
+
+// ActionBacklog summarises the active actions of one type and status.
+type ActionBacklog struct {
+	Type   ActionType
+	Status ActionStatus
+	Count  int
+	// Oldest is when the oldest of them was enqueued.
+	Oldest time.Time
+}
+
+// Backlog counts pending and running actions by type and status.
+func (store *PostgresActionStore) Backlog(ctx context.Context) ([]ActionBacklog, error) {
+	rows, err := store.DB.QueryContext(ctx, `
+        SELECT type, status, COUNT(*), MIN(createdat)
+        FROM actions
+        WHERE status IN ('pending', 'running')
+        GROUP BY type, status
+        ORDER BY type, status
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var backlog []ActionBacklog
+	for rows.Next() {
+		var b ActionBacklog
+		if err := rows.Scan(&b.Type, &b.Status, &b.Count, &b.Oldest); err != nil {
+			return nil, err
+		}
+		backlog = append(backlog, b)
+	}
+	return backlog, rows.Err()
+}
@@ -2,26 +2,70 @@ package execute_test
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/nabutabu/crane-oss/internal/execute"
+	"github.com/nabutabu/crane-oss/internal/logging"
 )
 
 // ------------------- Enqueue -------------------
 func TestPostgresActionStore_Enqueue(t *testing.T) {
+	action := &execute.Action{
+		HostID:      "1",
+		Type:        "restart",
+		RequestID:   "req-1",
+		TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+	createdAt := time.Now()
+
 	tests := []struct {
 		name    string
-		action  *execute.Action
-		wantErr bool
+		setup   func(mock sqlmock.Sqlmock)
+		wantID  int
+		wantErr error
 	}{
 		{
 			name: "success",
-			action: &execute.Action{
-				HostID: "1",
-				Type:   "restart",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("INSERT INTO actions").
+					WithArgs(action.HostID, action.Type, action.RequestID, action.TraceParent).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status", "attempts", "createdat"}).
+						AddRow(123, "pending", 0, createdAt))
+			},
+			wantID: 123,
+		},
+		{
+			name: "already queued",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("INSERT INTO actions").
+					WithArgs(action.HostID, action.Type, action.RequestID, action.TraceParent).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status", "attempts", "createdat"}))
+				mock.ExpectQuery("SELECT id, type, status, attempts, requestid, traceparent, createdat FROM actions").
+					WithArgs(action.HostID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "type", "status", "attempts", "requestid", "traceparent", "createdat"}).
+						AddRow(7, "restart", "running", 1, "req-0", "", createdAt))
+			},
+			wantID:  7,
+			wantErr: execute.ErrAlreadyQueued,
+		},
+		{
+			name: "active action finished in between",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("INSERT INTO actions").
+					WithArgs(action.HostID, action.Type, action.RequestID, action.TraceParent).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status", "attempts", "createdat"}))
+				mock.ExpectQuery("SELECT id, type, status, attempts, requestid, traceparent, createdat FROM actions").
+					WithArgs(action.HostID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "type", "status", "attempts", "requestid", "traceparent", "createdat"}))
+				mock.ExpectQuery("INSERT INTO actions").
+					WithArgs(action.HostID, action.Type, action.RequestID, action.TraceParent).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status", "attempts", "createdat"}).
+						AddRow(124, "pending", 0, createdAt))
 			},
-			wantErr: false,
+			wantID: 124,
 		},
 	}
 
@@ -29,23 +73,15 @@ func TestPostgresActionStore_Enqueue(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			db, mock, _ := sqlmock.New()
 			defer db.Close()
-			store := execute.PostgresActionStore{DB: *db}
+			store := execute.PostgresActionStore{DB: db, Logger: logging.Discard()}
+			tt.setup(mock)
 
-			if tt.action != nil {
-				mock.ExpectQuery("INSERT INTO actions").
-					WithArgs(tt.action.HostID, tt.action.Type).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(123))
-			}
-
-			gotErr := store.Enqueue(context.Background(), tt.action)
-			if gotErr != nil {
-				if !tt.wantErr {
-					t.Errorf("Enqueue() failed: %v", gotErr)
-				}
-				return
+			record, gotErr := store.Enqueue(context.Background(), action)
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Fatalf("Enqueue() error = %v, want %v", gotErr, tt.wantErr)
 			}
-			if tt.wantErr {
-				t.Fatal("Enqueue() succeeded unexpectedly")
+			if record.ID != tt.wantID || record.HostID != action.HostID {
+				t.Errorf("Enqueue() = %+v, want action %d for host %s", record, tt.wantID, action.HostID)
 			}
 
 			if err := mock.ExpectationsWereMet(); err != nil {
@@ -67,8 +103,8 @@ func TestPostgresActionStore_Next(t *testing.T) {
 	}{
 		{
 			name: "success",
-			mockRows: sqlmock.NewRows([]string{"id", "hostid", "attempts", "type"}).
-				AddRow(1, "42", 1, "restart"),
+			mockRows: sqlmock.NewRows([]string{"id", "hostid", "attempts", "type", "requestid", "traceparent", "leaseexpiresat"}).
+				AddRow(1, "42", 1, "restart", "req-1", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", time.Now().Add(time.Minute)),
 			wantID:   1,
 			wantHost: "42",
 			wantType: "restart",
@@ -76,7 +112,7 @@ func TestPostgresActionStore_Next(t *testing.T) {
 		},
 		{
 			name:     "no rows",
-			mockRows: sqlmock.NewRows([]string{"id", "hostid", "attempts", "type"}),
+			mockRows: sqlmock.NewRows([]string{"id", "hostid", "attempts", "type", "requestid", "traceparent", "leaseexpiresat"}),
 			wantErr:  true,
 		},
 	}
@@ -85,11 +121,13 @@ func TestPostgresActionStore_Next(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			db, mock, _ := sqlmock.New()
 			defer db.Close()
-			store := execute.PostgresActionStore{DB: *db}
+			store := execute.PostgresActionStore{DB: db, Logger: logging.Discard()}
 
-			mock.ExpectQuery("UPDATE actions").WillReturnRows(tt.mockRows)
+			mock.ExpectQuery("UPDATE actions").
+				WithArgs("worker-1", time.Minute.Seconds()).
+				WillReturnRows(tt.mockRows)
 
-			record, err := store.Next(context.Background())
+			record, err := store.Next(context.Background(), "worker-1", time.Minute)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Next() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -98,12 +136,15 @@ func TestPostgresActionStore_Next(t *testing.T) {
 				return
 			}
 
-			if record.ID != tt.wantID || record.HostID != tt.wantHost || record.Type != execute.ActionType(tt.wantType) {
+			if record.ID != tt.wantID || record.HostID != tt.wantHost || record.Type != execute.ActionType(tt.wantType) || record.RequestID != "req-1" || record.TraceParent == "" {
 				t.Errorf("Next() returned wrong record: %+v", record)
 			}
 			if record.Status != execute.ActionRunning {
 				t.Errorf("Next() status = %v; want %v", record.Status, execute.ActionRunning)
 			}
+			if record.WorkerID != "worker-1" || record.LeaseExpiresAt.IsZero() {
+				t.Errorf("Next() lease = %q until %v; want leased to worker-1", record.WorkerID, record.LeaseExpiresAt)
+			}
 
 			if err := mock.ExpectationsWereMet(); err != nil {
 				t.Errorf("unfulfilled expectations: %v", err)
@@ -112,17 +153,141 @@ func TestPostgresActionStore_Next(t *testing.T) {
 	}
 }
 
+// ackCases are the outcomes every ack of a running action must handle.
+var ackCases = []struct {
+	name         string
+	rowsAffected int64
+	wantErr      error
+}{
+	{
+		name:         "success",
+		rowsAffected: 1,
+	},
+	{
+		name:         "lease lost",
+		rowsAffected: 0,
+		wantErr:      execute.ErrLeaseLost,
+	},
+}
+
 // ------------------- MarkDone -------------------
 func TestPostgresActionStore_MarkDone(t *testing.T) {
+	for _, tt := range ackCases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, _ := sqlmock.New()
+			defer db.Close()
+			store := execute.PostgresActionStore{DB: db, Logger: logging.Discard()}
+
+			mock.ExpectExec("UPDATE actions SET status='done'").
+				WithArgs(123, "worker-1").
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsAffected))
+
+			gotErr := store.MarkDone(context.Background(), 123, "worker-1")
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Errorf("MarkDone() error = %v, want %v", gotErr, tt.wantErr)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// ------------------- MarkFailed -------------------
+func TestPostgresActionStore_MarkFailed(t *testing.T) {
+	failedErr := execute.ErrUnsupportedAction
+
+	for _, tt := range ackCases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, _ := sqlmock.New()
+			defer db.Close()
+			store := execute.PostgresActionStore{DB: db, Logger: logging.Discard()}
+
+			mock.ExpectExec("UPDATE actions SET status='failed'").
+				WithArgs(failedErr.Error(), 123, "worker-1").
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsAffected))
+
+			gotErr := store.MarkFailed(context.Background(), 123, "worker-1", failedErr)
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Errorf("MarkFailed() error = %v, want %v", gotErr, tt.wantErr)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// ------------------- MarkRetry -------------------
+func TestPostgresActionStore_MarkRetry(t *testing.T) {
+	notBefore := time.Now().Add(time.Minute)
+	retryErr := errors.New("provider unavailable")
+
+	for _, tt := range ackCases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, _ := sqlmock.New()
+			defer db.Close()
+			store := execute.PostgresActionStore{DB: db, Logger: logging.Discard()}
+
+			mock.ExpectExec("UPDATE actions SET status='pending'").
+				WithArgs(retryErr.Error(), notBefore, 123, "worker-1").
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsAffected))
+
+			gotErr := store.MarkRetry(context.Background(), 123, "worker-1", retryErr, notBefore)
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Errorf("MarkRetry() error = %v, want %v", gotErr, tt.wantErr)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// ------------------- MarkDead -------------------
+func TestPostgresActionStore_MarkDead(t *testing.T) {
+	deadErr := errors.New("provider unavailable")
+
+	for _, tt := range ackCases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, _ := sqlmock.New()
+			defer db.Close()
+			store := execute.PostgresActionStore{DB: db, Logger: logging.Discard()}
+
+			mock.ExpectExec("UPDATE actions SET status='dead'").
+				WithArgs(deadErr.Error(), 123, "worker-1").
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsAffected))
+
+			gotErr := store.MarkDead(context.Background(), 123, "worker-1", deadErr)
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Errorf("MarkDead() error = %v, want %v", gotErr, tt.wantErr)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// ------------------- Heartbeat -------------------
+func TestPostgresActionStore_Heartbeat(t *testing.T) {
 	tests := []struct {
-		name    string
-		id      int
-		wantErr bool
+		name         string
+		rowsAffected int64
+		wantErr      error
 	}{
 		{
-			name:    "success",
-			id:      123,
-			wantErr: false,
+			name:         "success",
+			rowsAffected: 1,
+		},
+		{
+			name:         "lease lost",
+			rowsAffected: 0,
+			wantErr:      execute.ErrLeaseLost,
 		},
 	}
 
@@ -130,15 +295,15 @@ func TestPostgresActionStore_MarkDone(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			db, mock, _ := sqlmock.New()
 			defer db.Close()
-			store := execute.PostgresActionStore{DB: *db}
+			store := execute.PostgresActionStore{DB: db, Logger: logging.Discard()}
 
-			mock.ExpectExec("UPDATE actions SET status='done'").
-				WithArgs(tt.id).
-				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE actions").
+				WithArgs(time.Minute.Seconds(), 123, "worker-1").
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsAffected))
 
-			gotErr := store.MarkDone(context.Background(), tt.id)
-			if (gotErr != nil) != tt.wantErr {
-				t.Errorf("MarkDone() error = %v, wantErr %v", gotErr, tt.wantErr)
+			gotErr := store.Heartbeat(context.Background(), 123, "worker-1", time.Minute)
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Errorf("Heartbeat() error = %v, want %v", gotErr, tt.wantErr)
 			}
 
 			if err := mock.ExpectationsWereMet(); err != nil {
@@ -148,33 +313,105 @@ func TestPostgresActionStore_MarkDone(t *testing.T) {
 	}
 }
 
-// ------------------- MarkFailed -------------------
-func TestPostgresActionStore_MarkFailed(t *testing.T) {
+// ------------------- ReclaimExpired -------------------
+func TestPostgresActionStore_ReclaimExpired(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := execute.PostgresActionStore{DB: db, Logger: logging.Discard()}
+
+	mock.ExpectExec("UPDATE actions SET status = 'pending', (.+), workerid = '', leaseexpiresat = NULL").
+		WithArgs(execute.ErrLeaseExpired.Error()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	n, err := store.ReclaimExpired(context.Background())
+	if err != nil {
+		t.Fatalf("ReclaimExpired() failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("ReclaimExpired() = %d, want 2", n)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// ------------------- Cancellation -------------------
+func TestPostgresActionStore_Cancelled(t *testing.T) {
+	errTest := errors.New("boom")
 	tests := []struct {
-		name    string
-		id      int
-		wantErr bool
+		name string
+		call func(ctx context.Context, store *execute.PostgresActionStore) error
 	}{
-		{
-			name:    "success",
-			id:      123,
-			wantErr: false,
-		},
+		{name: "Enqueue", call: func(ctx context.Context, store *execute.PostgresActionStore) error {
+			_, err := store.Enqueue(ctx, &execute.Action{HostID: "1", Type: execute.ActionDrainHost})
+			return err
+		}},
+		{name: "Next", call: func(ctx context.Context, store *execute.PostgresActionStore) error {
+			_, err := store.Next(ctx, "worker-1", time.Minute)
+			return err
+		}},
+		{name: "Heartbeat", call: func(ctx context.Context, store *execute.PostgresActionStore) error {
+			return store.Heartbeat(ctx, 1, "worker-1", time.Minute)
+		}},
+		{name: "ReclaimExpired", call: func(ctx context.Context, store *execute.PostgresActionStore) error {
+			_, err := store.ReclaimExpired(ctx)
+			return err
+		}},
+		{name: "MarkDone", call: func(ctx context.Context, store *execute.PostgresActionStore) error {
+			return store.MarkDone(ctx, 1, "worker-1")
+		}},
+		{name: "MarkFailed", call: func(ctx context.Context, store *execute.PostgresActionStore) error {
+			return store.MarkFailed(ctx, 1, "worker-1", errTest)
+		}},
+		{name: "MarkRetry", call: func(ctx context.Context, store *execute.PostgresActionStore) error {
+			return store.MarkRetry(ctx, 1, "worker-1", errTest, time.Now())
+		}},
+		{name: "MarkDead", call: func(ctx context.Context, store *execute.PostgresActionStore) error {
+			return store.MarkDead(ctx, 1, "worker-1", errTest)
+		}},
+		{name: "MarkBlocked", call: func(ctx context.Context, store *execute.PostgresActionStore) error {
+			return store.MarkBlocked(ctx, 1, "worker-1", errTest, time.Now())
+		}},
+		{name: "Active", call: func(ctx context.Context, store *execute.PostgresActionStore) error {
+			_, err := store.Active(ctx)
+			return err
+		}},
 	}
 
 	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _, _ := sqlmock.New()
+			defer db.Close()
+			store := &execute.PostgresActionStore{DB: db, Logger: logging.Discard()}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if err := tt.call(ctx, store); !errors.Is(err, context.Canceled) {
+				t.Errorf("%s() error = %v, want %v", tt.name, err, context.Canceled)
+			}
+		})
+	}
+}
+
+// ------------------- MarkBlocked -------------------
+func TestPostgresActionStore_MarkBlocked(t *testing.T) {
+	notBefore := time.Now().Add(time.Minute)
+	blockedErr := errors.New("budget exhausted")
+
+	for _, tt := range ackCases {
 		t.Run(tt.name, func(t *testing.T) {
 			db, mock, _ := sqlmock.New()
 			defer db.Close()
-			store := execute.PostgresActionStore{DB: *db}
+			store := execute.PostgresActionStore{DB: db, Logger: logging.Discard()}
 
-			mock.ExpectExec("UPDATE actions SET status='failed'").
-				WithArgs(tt.id).
-				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE actions").
+				WithArgs(blockedErr.Error(), notBefore, 123, "worker-1").
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsAffected))
 
-			gotErr := store.MarkFailed(context.Background(), tt.id)
-			if (gotErr != nil) != tt.wantErr {
-				t.Errorf("MarkFailed() error = %v, wantErr %v", gotErr, tt.wantErr)
+			gotErr := store.MarkBlocked(context.Background(), 123, "worker-1", blockedErr, notBefore)
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Errorf("MarkBlocked() error = %v, want %v", gotErr, tt.wantErr)
 			}
 
 			if err := mock.ExpectationsWereMet(); err != nil {
@@ -183,3 +420,62 @@ func TestPostgresActionStore_MarkFailed(t *testing.T) {
 		})
 	}
 }
+
+// ------------------- Active -------------------
+func TestPostgresActionStore_Active(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := execute.PostgresActionStore{DB: db, Logger: logging.Discard()}
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM actions").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "hostid", "type", "status", "attempts", "lasterror", "notbefore", "workerid", "createdat", "updatedat"}).
+			AddRow(1, "host-1", "drain_host", "running", 1, "", now, "worker-0", now, now).
+			AddRow(2, "host-2", "replace_host", "pending", 0, "", now, "", now, now))
+
+	records, err := store.Active(context.Background())
+	if err != nil {
+		t.Fatalf("Active() failed: %v", err)
+	}
+	if len(records) != 2 || records[0].Status != execute.ActionRunning || records[1].HostID != "host-2" {
+		t.Errorf("Active() = %+v", records)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// ------------------- Backlog -------------------
+func TestPostgresActionStore_Backlog(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := execute.PostgresActionStore{DB: db, Logger: logging.Discard()}
+
+	oldest := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(`SELECT type, status, COUNT\(\*\), MIN\(createdat\) FROM actions WHERE status IN \('pending', 'running'\) GROUP BY type, status`).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "status", "count", "min"}).
+			AddRow("drain_host", "pending", 3, oldest).
+			AddRow("replace_host", "running", 1, oldest))
+
+	backlog, err := store.Backlog(context.Background())
+	if err != nil {
+		t.Fatalf("Backlog() failed: %v", err)
+	}
+	want := []execute.ActionBacklog{
+		{Type: execute.ActionDrainHost, Status: execute.ActionPending, Count: 3, Oldest: oldest},
+		{Type: execute.ActionReplaceHost, Status: execute.ActionRunning, Count: 1, Oldest: oldest},
+	}
+	if len(backlog) != len(want) {
+		t.Fatalf("Backlog() = %+v, want %+v", backlog, want)
+	}
+	for i := range want {
+		if backlog[i] != want[i] {
+			t.Errorf("Backlog()[%d] = %+v, want %+v", i, backlog[i], want[i])
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
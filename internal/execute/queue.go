@@ -1,10 +1,55 @@
 package execute
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrAlreadyQueued is returned by Enqueue, along with the existing
+	// record, when the host already has a pending or running action.
+	ErrAlreadyQueued = errors.New("host already has an active action")
+	// ErrLeaseLost is returned by Heartbeat and the Mark methods when the
+	// action is no longer leased to the worker, typically because the
+	// janitor reclaimed it.
+	ErrLeaseLost = errors.New("action lease lost")
+	// ErrLeaseExpired is recorded on actions whose worker stopped
+	// heartbeating before finishing them.
+	ErrLeaseExpired = errors.New("action lease expired")
+)
 
 type ActionStore interface {
-	Enqueue(ctx context.Context, action *Action) error
-	Next(ctx context.Context) (*ActionRecord, error)
-	MarkDone(ctx context.Context, id int) error
-	MarkFailed(ctx context.Context, id int) error
+	// Enqueue adds action to the queue. A host has at most one pending or
+	// running action; if it already has one, Enqueue returns that record and
+	// ErrAlreadyQueued.
+	Enqueue(ctx context.Context, action *Action) (*ActionRecord, error)
+	// Next claims the oldest pending action for workerID and leases it to
+	// the worker for lease. It returns sql.ErrNoRows when nothing is due.
+	Next(ctx context.Context, workerID string, lease time.Duration) (*ActionRecord, error)
+	// Heartbeat extends the lease on a running action. It returns
+	// ErrLeaseLost if the action is no longer leased to workerID.
+	Heartbeat(ctx context.Context, id int, workerID string, lease time.Duration) error
+	// ReclaimExpired returns running actions whose lease has expired to the
+	// queue and reports how many there were.
+	ReclaimExpired(ctx context.Context) (int, error)
+	// The Mark methods record what became of an action claimed by workerID.
+	// They return ErrLeaseLost, and change nothing, if the action is no
+	// longer leased to workerID, so that a worker that was too slow cannot
+	// overwrite the outcome of the one that took over.
+	MarkDone(ctx context.Context, id int, workerID string) error
+	// MarkFailed fails an action for good, recording the error that failed
+	// it.
+	MarkFailed(ctx context.Context, id int, workerID string, err error) error
+	// MarkRetry returns a claimed action to the queue, recording err; Next
+	// does not hand it out again before notBefore.
+	MarkRetry(ctx context.Context, id int, workerID string, err error, notBefore time.Time) error
+	// MarkDead gives up on an action, recording the error that killed it.
+	MarkDead(ctx context.Context, id int, workerID string, err error) error
+	// MarkBlocked returns a claimed action that was not allowed to run to
+	// the queue, recording why. Unlike MarkRetry the claim does not count as
+	// an attempt.
+	MarkBlocked(ctx context.Context, id int, workerID string, err error, notBefore time.Time) error
+	// Active returns every pending and running action, oldest first.
+	Active(ctx context.Context) ([]*ActionRecord, error)
 }
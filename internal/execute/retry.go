@@ -0,0 +1,80 @@
+package execute
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/provider"
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+// RetryPolicy decides how often, and how far apart, a failing action is
+// attempted.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, including the first, after
+	// which the action is marked dead.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with every
+	// further attempt, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy applies to action types without a policy of their own.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   10 * time.Second,
+	MaxDelay:    10 * time.Minute,
+}
+
+// DefaultRetryPolicies are the per-type policies used when WorkerPoolConfig
+// does not set any. Replaces provision hardware, so they back off for longer
+// and give up sooner.
+var DefaultRetryPolicies = map[ActionType]RetryPolicy{
+	ActionDrainHost: DefaultRetryPolicy,
+	ActionReplaceHost: {
+		MaxAttempts: 3,
+		BaseDelay:   time.Minute,
+		MaxDelay:    30 * time.Minute,
+	},
+}
+
+// Exhausted reports whether an action that has been attempted attempts
+// times should not be retried again.
+func (p RetryPolicy) Exhausted(attempts int) bool {
+	return attempts >= p.MaxAttempts
+}
+
+// Backoff returns how long to wait before the retry following attempt
+// number attempts. The delay grows exponentially and is jittered into
+// [delay/2, delay] so that actions that failed together do not retry in
+// lockstep.
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// retryable reports whether an action that failed with err may succeed if
+// attempted again. Errors that say the action itself is wrong, rather than
+// that something it depends on is unavailable, are permanent.
+func retryable(err error) bool {
+	switch {
+	case errors.Is(err, ErrUnsupportedAction),
+		errors.Is(err, provider.ErrUnknownProvider),
+		errors.Is(err, api.ErrNotFound),
+		errors.Is(err, api.ErrValidation),
+		errors.Is(err, api.ErrInvalidTransition):
+		return false
+	}
+	return true
+}
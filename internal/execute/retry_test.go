@@ -0,0 +1,42 @@
+package execute_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/execute"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := execute.RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+
+	tests := []struct {
+		attempts int
+		max      time.Duration
+	}{
+		{attempts: 1, max: time.Second},
+		{attempts: 2, max: 2 * time.Second},
+		{attempts: 4, max: 8 * time.Second},
+		{attempts: 6, max: 30 * time.Second},
+		{attempts: 100, max: 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for range 20 {
+			got := policy.Backoff(tt.attempts)
+			if got < tt.max/2 || got > tt.max {
+				t.Fatalf("Backoff(%d) = %s, want within [%s, %s]", tt.attempts, got, tt.max/2, tt.max)
+			}
+		}
+	}
+}
+
+func TestRetryPolicy_Exhausted(t *testing.T) {
+	policy := execute.RetryPolicy{MaxAttempts: 3}
+
+	for attempts, want := range map[int]bool{1: false, 2: false, 3: true, 4: true} {
+		if got := policy.Exhausted(attempts); got != want {
+			t.Errorf("Exhausted(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
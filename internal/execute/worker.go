@@ -2,23 +2,350 @@ package execute
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/logging"
+	"github.com/nabutabu/crane-oss/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type Worker struct {
-	store    ActionStore
-	executor Executor
+// ackTimeout bounds how long a worker waits to record the outcome of an
+// action once it has been executed.
+const ackTimeout = 10 * time.Second
+
+var tracer = otel.Tracer("github.com/nabutabu/crane-oss/internal/execute")
+
+// DefaultLease is how long a claimed action stays leased to its worker
+// without a heartbeat.
+const DefaultLease = time.Minute
+
+type WorkerPoolConfig struct {
+	// Size is the number of workers polling the queue concurrently.
+	Size int
+	// PollInterval is how long an idle worker waits before polling again.
+	// The wait doubles while the queue stays empty, up to MaxPollInterval.
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+	// Lease is how long a claimed action stays leased to its worker. Workers
+	// heartbeat three times per lease while executing.
+	Lease time.Duration
+	// Gate, if set, is asked before every action is executed. Actions it
+	// rejects go back to the queue for MaxPollInterval.
+	Gate Gate
+	// RetryPolicies maps action types to their retry policy. Types without
+	// an entry use DefaultRetryPolicy; a nil map uses DefaultRetryPolicies.
+	RetryPolicies map[ActionType]RetryPolicy
+	// Logger defaults to slog.Default.
+	Logger *slog.Logger
+}
+
+// Gate decides whether a claimed action may run now. An action that is not
+// admitted is returned to the queue with the error recorded and tried again
+// later; it does not count as an attempt.
+type Gate interface {
+	Admit(ctx context.Context, record *ActionRecord) error
+}
+
+// WorkerPool runs a fixed number of Workers against the same queue. Claims
+// are exclusive (see ActionStore.Next), so workers never run the same action
+// twice.
+type WorkerPool struct {
+	workers []*Worker
+}
+
+func NewWorkerPool(store ActionStore, executor Executor, cfg WorkerPoolConfig) *WorkerPool {
+	if cfg.MaxPollInterval < cfg.PollInterval {
+		cfg.MaxPollInterval = cfg.PollInterval
+	}
+	if cfg.RetryPolicies == nil {
+		cfg.RetryPolicies = DefaultRetryPolicies
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = DefaultLease
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	// worker IDs end up in the actions table, so they have to be unique
+	// across every crane-api process sharing the queue
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	pool := &WorkerPool{}
+	for i := range cfg.Size {
+		id := fmt.Sprintf("%s-%d/worker-%d", hostname, os.Getpid(), i)
+		pool.workers = append(pool.workers, &Worker{
+			id:              id,
+			logger:          cfg.Logger.With("worker_id", id),
+			store:           store,
+			executor:        executor,
+			pollInterval:    cfg.PollInterval,
+			maxPollInterval: cfg.MaxPollInterval,
+			lease:           cfg.Lease,
+			gate:            cfg.Gate,
+			retryPolicies:   cfg.RetryPolicies,
+		})
+	}
+	return pool
 }
 
-func (w *Worker) do(ctx context.Context) error {
-	for record, err := w.store.Next(ctx); err != nil; {
-		err := w.executor.Execute(ctx, &Action{
-			HostID: record.HostID,
-			Type:   record.Type,
+// Run starts every worker and blocks until ctx is cancelled and all of them
+// have returned.
+func (p *WorkerPool) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, w := range p.workers {
+		wg.Go(func() {
+			w.Run(ctx)
 		})
-		if err != nil {
-			return err
+	}
+	wg.Wait()
+}
+
+// Worker claims actions from the queue one at a time, executes them and
+// records the outcome.
+type Worker struct {
+	id              string
+	store           ActionStore
+	executor        Executor
+	pollInterval    time.Duration
+	maxPollInterval time.Duration
+	lease           time.Duration
+	gate            Gate
+	retryPolicies   map[ActionType]RetryPolicy
+	logger          *slog.Logger
+}
+
+// Run processes actions until ctx is cancelled. While the queue is empty, or
+// the store is failing, the worker backs off exponentially.
+func (w *Worker) Run(ctx context.Context) {
+	wait := w.pollInterval
+
+	for ctx.Err() == nil {
+		record, err := w.do(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.logError(ctx, record, err)
+		}
+
+		if record != nil {
+			wait = w.pollInterval
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, w.maxPollInterval)
+	}
+}
+
+// logError logs an error from do, with the action it concerns if one was
+// claimed.
+func (w *Worker) logError(ctx context.Context, record *ActionRecord, err error) {
+	if record == nil {
+		w.logger.ErrorContext(ctx, "claim action", "error", err)
+		return
+	}
+
+	ctx = logging.WithRequestID(ctx, record.RequestID)
+	w.logger.ErrorContext(ctx, "action failed",
+		logging.KeyActionID, record.ID,
+		logging.KeyHostID, record.HostID,
+		"type", record.Type,
+		"attempt", record.Attempts,
+		"error", err,
+	)
+}
+
+// do claims and runs at most one action. It returns the action it claimed,
+// if any, so Run knows whether the queue is drained.
+func (w *Worker) do(ctx context.Context) (*ActionRecord, error) {
+	record, err := w.store.Next(ctx, w.id, w.lease)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim action: %w", err)
+	}
+	actionsClaimed.WithLabelValues(string(record.Type)).Inc()
+
+	// whatever the action does is part of the request and trace that
+	// caused it
+	ctx = logging.WithRequestID(ctx, record.RequestID)
+	ctx = tracing.WithTraceParent(ctx, record.TraceParent)
+	ctx, span := tracer.Start(ctx, "Worker.run",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			tracing.KeyActionID.Int(record.ID),
+			tracing.KeyHostID.String(record.HostID),
+			tracing.KeyRequestID.String(record.RequestID),
+			attribute.String("type", string(record.Type)),
+			attribute.Int("attempt", record.Attempts),
+			attribute.String("worker_id", w.id),
+		),
+	)
+	err = w.run(ctx, record)
+	tracing.End(span, err)
+	return record, err
+}
+
+// run runs an action claimed by do and records its outcome.
+func (w *Worker) run(ctx context.Context, record *ActionRecord) error {
+	logger := w.logger.With(
+		logging.KeyActionID, record.ID,
+		logging.KeyHostID, record.HostID,
+		"type", record.Type,
+	)
+
+	// record the outcome even if we are shutting down, otherwise the
+	// action would stay running until its lease expires
+	ackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ackTimeout)
+	defer cancel()
+
+	// an action claimed more often than its policy allows was reclaimed
+	// from workers that died running it; don't let it take down another one
+	if policy := w.retryPolicy(record.Type); policy.Exhausted(record.Attempts - 1) {
+		deadErr := fmt.Errorf("action %d (%s on %s): %w on attempt %d", record.ID, record.Type, record.HostID, ErrLeaseExpired, record.Attempts-1)
+		actionsFailed.WithLabelValues(string(record.Type), string(ActionDead)).Inc()
+		if err := w.store.MarkDead(ackCtx, record.ID, w.id, deadErr); err != nil {
+			return errors.Join(deadErr, fmt.Errorf("mark action %d dead: %w", record.ID, err))
+		}
+		return deadErr
+	}
+
+	if w.gate != nil {
+		if err := w.gate.Admit(ctx, record); err != nil {
+			blockedErr := fmt.Errorf("action %d (%s on %s) held back: %w", record.ID, record.Type, record.HostID, err)
+			actionsBlocked.WithLabelValues(string(record.Type)).Inc()
+			if err := w.store.MarkBlocked(ackCtx, record.ID, w.id, blockedErr, time.Now().Add(w.maxPollInterval)); err != nil {
+				return errors.Join(blockedErr, fmt.Errorf("mark action %d blocked: %w", record.ID, err))
+			}
+			logger.InfoContext(ctx, "action held back", "error", err)
+			trace.SpanFromContext(ctx).AddEvent("action held back",
+				trace.WithAttributes(attribute.String("error", err.Error())))
+			return nil
+		}
+	}
+
+	logger.InfoContext(ctx, "action started", "attempt", record.Attempts)
+	start := time.Now()
+
+	execCtx, cancelExec := context.WithCancel(ctx)
+	var lost atomic.Bool
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		if w.heartbeat(execCtx, logger, record.ID) {
+			lost.Store(true)
+			cancelExec()
+		}
+	})
+
+	execErr := w.executor.Execute(execCtx, &Action{
+		HostID: record.HostID,
+		Type:   record.Type,
+	})
+	cancelExec()
+	wg.Wait()
+
+	if lost.Load() {
+		// the action belongs to someone else now, so its outcome is not
+		// ours to record
+		return fmt.Errorf("action %d (%s on %s): %w", record.ID, record.Type, record.HostID, ErrLeaseLost)
+	}
+
+	if execErr != nil && ctx.Err() != nil {
+		// we are shutting down, which is no fault of the action: hand it
+		// back for another worker to pick up without spending an attempt
+		execErr = fmt.Errorf("action %d (%s on %s) interrupted: %w", record.ID, record.Type, record.HostID, execErr)
+		if err := w.store.MarkBlocked(ackCtx, record.ID, w.id, execErr, time.Now()); err != nil {
+			return errors.Join(execErr, fmt.Errorf("hand back action %d: %w", record.ID, err))
+		}
+		logger.InfoContext(ctx, "action handed back", "error", execErr)
+		return execErr
+	}
+	if execErr != nil {
+		execErr = fmt.Errorf("action %d (%s on %s) attempt %d failed: %w", record.ID, record.Type, record.HostID, record.Attempts, execErr)
+		if err := w.fail(ackCtx, record, execErr); err != nil {
+			return errors.Join(execErr, err)
 		}
+		return execErr
 	}
 
+	if err := w.store.MarkDone(ackCtx, record.ID, w.id); err != nil {
+		return fmt.Errorf("mark action %d done: %w", record.ID, err)
+	}
+	actionsDone.WithLabelValues(string(record.Type)).Inc()
+	logger.InfoContext(ctx, "action done", "duration", time.Since(start))
+	return nil
+}
+
+// heartbeat extends the lease on action id until ctx is done. It reports
+// whether the lease was lost.
+func (w *Worker) heartbeat(ctx context.Context, logger *slog.Logger, id int) bool {
+	ticker := time.NewTicker(w.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+
+		err := w.store.Heartbeat(ctx, id, w.id, w.lease)
+		if errors.Is(err, ErrLeaseLost) {
+			return true
+		}
+		// a failed heartbeat is retried on the next tick; the lease only
+		// runs out if they keep failing
+		if err != nil && ctx.Err() == nil {
+			logger.WarnContext(ctx, "heartbeat", "error", err)
+		}
+	}
+}
+
+func (w *Worker) retryPolicy(t ActionType) RetryPolicy {
+	if policy, ok := w.retryPolicies[t]; ok {
+		return policy
+	}
+	return DefaultRetryPolicy
+}
+
+// fail records a failed attempt: permanent errors fail the action, others
+// put it back in the queue until its retry policy is exhausted.
+func (w *Worker) fail(ctx context.Context, record *ActionRecord, execErr error) error {
+	policy := w.retryPolicy(record.Type)
+
+	switch {
+	case !retryable(execErr):
+		actionsFailed.WithLabelValues(string(record.Type), string(ActionFailed)).Inc()
+		if err := w.store.MarkFailed(ctx, record.ID, w.id, execErr); err != nil {
+			return fmt.Errorf("mark action %d failed: %w", record.ID, err)
+		}
+	case policy.Exhausted(record.Attempts):
+		actionsFailed.WithLabelValues(string(record.Type), string(ActionDead)).Inc()
+		if err := w.store.MarkDead(ctx, record.ID, w.id, execErr); err != nil {
+			return fmt.Errorf("mark action %d dead: %w", record.ID, err)
+		}
+	default:
+		actionsFailed.WithLabelValues(string(record.Type), "retry").Inc()
+		notBefore := time.Now().Add(policy.Backoff(record.Attempts))
+		if err := w.store.MarkRetry(ctx, record.ID, w.id, execErr, notBefore); err != nil {
+			return fmt.Errorf("mark action %d for retry: %w", record.ID, err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,605 @@
+package execute_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/execute"
+	"github.com/nabutabu/crane-oss/internal/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeActionStore is an in-memory queue with the claim semantics of
+// PostgresActionStore.
+type fakeActionStore struct {
+	mu      sync.Mutex
+	records map[int]*execute.ActionRecord
+	pending []*execute.ActionRecord
+	done    []int
+	failed  []int
+	dead    []int
+	nextID  int
+	// leaseLost makes Heartbeat report that the lease was taken away.
+	leaseLost bool
+}
+
+func (s *fakeActionStore) Enqueue(ctx context.Context, action *execute.Action) (*execute.ActionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records == nil {
+		s.records = make(map[int]*execute.ActionRecord)
+	}
+	for _, record := range s.records {
+		if record.HostID == action.HostID && (record.Status == execute.ActionPending || record.Status == execute.ActionRunning) {
+			existing := *record
+			return &existing, execute.ErrAlreadyQueued
+		}
+	}
+	s.nextID++
+	record := &execute.ActionRecord{
+		ID:          s.nextID,
+		HostID:      action.HostID,
+		Type:        action.Type,
+		Status:      execute.ActionPending,
+		RequestID:   action.RequestID,
+		TraceParent: action.TraceParent,
+	}
+	s.records[record.ID] = record
+	s.pending = append(s.pending, record)
+	created := *record
+	return &created, nil
+}
+
+func (s *fakeActionStore) Next(ctx context.Context, workerID string, lease time.Duration) (*execute.ActionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, record := range s.pending {
+		if record.NotBefore.After(time.Now()) {
+			continue
+		}
+		s.pending = append(s.pending[:i:i], s.pending[i+1:]...)
+		record.Status = execute.ActionRunning
+		record.Attempts++
+		record.WorkerID = workerID
+		record.LeaseExpiresAt = time.Now().Add(lease)
+		claimed := *record
+		return &claimed, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+// leased returns action id if it is running under workerID.
+func (s *fakeActionStore) leased(id int, workerID string) (*execute.ActionRecord, error) {
+	record := s.records[id]
+	if record.Status != execute.ActionRunning || record.WorkerID != workerID {
+		return nil, execute.ErrLeaseLost
+	}
+	return record, nil
+}
+
+func (s *fakeActionStore) MarkDone(ctx context.Context, id int, workerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, err := s.leased(id, workerID)
+	if err != nil {
+		return err
+	}
+	record.Status = execute.ActionDone
+	s.done = append(s.done, id)
+	return nil
+}
+
+func (s *fakeActionStore) MarkFailed(ctx context.Context, id int, workerID string, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, leaseErr := s.leased(id, workerID)
+	if leaseErr != nil {
+		return leaseErr
+	}
+	record.Status = execute.ActionFailed
+	record.LastError = err.Error()
+	s.failed = append(s.failed, id)
+	return nil
+}
+
+func (s *fakeActionStore) MarkRetry(ctx context.Context, id int, workerID string, err error, notBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, leaseErr := s.leased(id, workerID)
+	if leaseErr != nil {
+		return leaseErr
+	}
+	record.Status = execute.ActionPending
+	record.WorkerID = ""
+	record.LastError = err.Error()
+	record.NotBefore = notBefore
+	s.pending = append(s.pending, record)
+	return nil
+}
+
+func (s *fakeActionStore) MarkDead(ctx context.Context, id int, workerID string, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, leaseErr := s.leased(id, workerID)
+	if leaseErr != nil {
+		return leaseErr
+	}
+	record.Status = execute.ActionDead
+	record.LastError = err.Error()
+	s.dead = append(s.dead, id)
+	return nil
+}
+
+func (s *fakeActionStore) Heartbeat(ctx context.Context, id int, workerID string, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.leaseLost || s.records[id].WorkerID != workerID {
+		return execute.ErrLeaseLost
+	}
+	s.records[id].LeaseExpiresAt = time.Now().Add(lease)
+	return nil
+}
+
+func (s *fakeActionStore) ReclaimExpired(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, record := range s.records {
+		if record.Status == execute.ActionRunning && record.LeaseExpiresAt.Before(time.Now()) {
+			record.Status = execute.ActionPending
+			record.WorkerID = ""
+			record.LastError = execute.ErrLeaseExpired.Error()
+			s.pending = append(s.pending, record)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *fakeActionStore) MarkBlocked(ctx context.Context, id int, workerID string, err error, notBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, leaseErr := s.leased(id, workerID)
+	if leaseErr != nil {
+		return leaseErr
+	}
+	record.Status = execute.ActionPending
+	record.WorkerID = ""
+	record.Attempts--
+	record.LastError = err.Error()
+	record.NotBefore = notBefore
+	s.pending = append(s.pending, record)
+	return nil
+}
+
+func (s *fakeActionStore) Active(ctx context.Context) ([]*execute.ActionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var active []*execute.ActionRecord
+	for _, record := range s.records {
+		if record.Status == execute.ActionPending || record.Status == execute.ActionRunning {
+			copied := *record
+			active = append(active, &copied)
+		}
+	}
+	return active, nil
+}
+
+func (s *fakeActionStore) record(id int) execute.ActionRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.records[id]
+}
+
+func (s *fakeActionStore) finished() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.done) + len(s.failed) + len(s.dead)
+}
+
+type executorFunc func(ctx context.Context, action *execute.Action) error
+
+func (f executorFunc) Execute(ctx context.Context, action *execute.Action) error {
+	return f(ctx, action)
+}
+
+func TestWorkerPool_Run(t *testing.T) {
+	store := &fakeActionStore{}
+	for _, host := range []string{"host-1", "host-2", "broken", "host-3"} {
+		store.Enqueue(context.Background(), &execute.Action{
+			HostID:      host,
+			Type:        execute.ActionDrainHost,
+			RequestID:   "req-" + host,
+			TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		})
+	}
+
+	var mu sync.Mutex
+	executed := make(map[string]int)
+	executor := executorFunc(func(ctx context.Context, action *execute.Action) error {
+		mu.Lock()
+		executed[action.HostID]++
+		mu.Unlock()
+
+		if got, want := logging.RequestID(ctx), "req-"+action.HostID; got != want {
+			t.Errorf("%s executed with request ID %q, want %q", action.HostID, got, want)
+		}
+		if got := trace.SpanContextFromContext(ctx).TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("%s executed in trace %s, want the trace that enqueued it", action.HostID, got)
+		}
+
+		if action.HostID == "broken" {
+			return execute.ErrUnsupportedAction
+		}
+		return nil
+	})
+
+	pool := execute.NewWorkerPool(store, executor, execute.WorkerPoolConfig{
+		Size:            3,
+		PollInterval:    time.Millisecond,
+		MaxPollInterval: 5 * time.Millisecond,
+		Logger:          logging.Discard(),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(stopped)
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for store.finished() < 4 {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for actions, %d finished", store.finished())
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("pool did not stop after cancellation")
+	}
+
+	for host, n := range executed {
+		if n != 1 {
+			t.Errorf("%s executed %d times, want 1", host, n)
+		}
+	}
+	if len(store.done) != 3 || len(store.failed) != 1 {
+		t.Errorf("done = %v, failed = %v; want 3 done and 1 failed", store.done, store.failed)
+	}
+}
+
+func TestWorkerPool_StopsWhenIdle(t *testing.T) {
+	pool := execute.NewWorkerPool(&fakeActionStore{}, executorFunc(func(context.Context, *execute.Action) error {
+		t.Errorf("executor called on an empty queue")
+		return nil
+	}), execute.WorkerPoolConfig{Size: 2, PollInterval: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("idle pool did not stop after cancellation")
+	}
+}
+
+// runUntilFinished runs pool until n actions have reached a final status.
+func runUntilFinished(t *testing.T, pool *execute.WorkerPool, store *fakeActionStore, n int) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for store.finished() < n {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for actions, %d finished", store.finished())
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestWorkerPool_Retry(t *testing.T) {
+	errTransient := errors.New("provider unavailable")
+
+	tests := []struct {
+		name         string
+		failures     int
+		err          error
+		wantStatus   execute.ActionStatus
+		wantAttempts int
+	}{
+		{name: "succeeds after transient failures", failures: 2, err: errTransient, wantStatus: execute.ActionDone, wantAttempts: 3},
+		{name: "dead once attempts are exhausted", failures: 10, err: errTransient, wantStatus: execute.ActionDead, wantAttempts: 3},
+		{name: "permanent errors are not retried", failures: 10, err: execute.ErrUnsupportedAction, wantStatus: execute.ActionFailed, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeActionStore{}
+			store.Enqueue(context.Background(), &execute.Action{HostID: "host-1", Type: execute.ActionDrainHost})
+
+			var mu sync.Mutex
+			attempts := 0
+			executor := executorFunc(func(ctx context.Context, action *execute.Action) error {
+				mu.Lock()
+				defer mu.Unlock()
+				attempts++
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+
+			pool := execute.NewWorkerPool(store, executor, execute.WorkerPoolConfig{
+				Size:         1,
+				PollInterval: time.Millisecond,
+				RetryPolicies: map[execute.ActionType]execute.RetryPolicy{
+					execute.ActionDrainHost: {MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+				},
+			})
+			runUntilFinished(t, pool, store, 1)
+
+			record := store.record(1)
+			if record.Status != tt.wantStatus || record.Attempts != tt.wantAttempts {
+				t.Errorf("action status = %s after %d attempts, want %s after %d", record.Status, record.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if tt.wantStatus != execute.ActionDone && record.LastError == "" {
+				t.Errorf("%s action has no last error", record.Status)
+			}
+		})
+	}
+}
+
+func TestWorkerPool_HeartbeatExtendsLease(t *testing.T) {
+	store := &fakeActionStore{}
+	store.Enqueue(context.Background(), &execute.Action{HostID: "host-1", Type: execute.ActionDrainHost})
+
+	// the drain outlives its lease several times over
+	executor := executorFunc(func(ctx context.Context, action *execute.Action) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+
+	pool := execute.NewWorkerPool(store, executor, execute.WorkerPoolConfig{
+		Size:         1,
+		PollInterval: time.Millisecond,
+		Lease:        15 * time.Millisecond,
+	})
+	janitor := execute.NewJanitor(store, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go janitor.Run(ctx)
+
+	runUntilFinished(t, pool, store, 1)
+
+	if record := store.record(1); record.Status != execute.ActionDone || record.Attempts != 1 {
+		t.Errorf("action status = %s after %d attempts, want done after 1", record.Status, record.Attempts)
+	}
+}
+
+func TestWorkerPool_LeaseLost(t *testing.T) {
+	store := &fakeActionStore{leaseLost: true}
+	store.Enqueue(context.Background(), &execute.Action{HostID: "host-1", Type: execute.ActionDrainHost})
+
+	cancelled := make(chan struct{})
+	executor := executorFunc(func(ctx context.Context, action *execute.Action) error {
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+
+	pool := execute.NewWorkerPool(store, executor, execute.WorkerPoolConfig{
+		Size:         1,
+		PollInterval: time.Hour,
+		Lease:        3 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(stopped)
+	}()
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("execution was not cancelled after the lease was lost")
+	}
+	cancel()
+	<-stopped
+
+	// the new lease holder records the outcome, not us
+	if status := store.record(1).Status; status != execute.ActionRunning {
+		t.Errorf("action status = %s, want %s", status, execute.ActionRunning)
+	}
+}
+
+func TestWorkerPool_LeaseLostBeforeHeartbeat(t *testing.T) {
+	store := &fakeActionStore{}
+	store.Enqueue(context.Background(), &execute.Action{HostID: "host-1", Type: execute.ActionDrainHost})
+
+	// the action is reclaimed and claimed by another worker before this
+	// one heartbeats even once
+	executed := make(chan struct{})
+	executor := executorFunc(func(ctx context.Context, action *execute.Action) error {
+		store.mu.Lock()
+		store.records[1].WorkerID = "other-worker"
+		store.mu.Unlock()
+		close(executed)
+		return nil
+	})
+
+	pool := execute.NewWorkerPool(store, executor, execute.WorkerPoolConfig{
+		Size:         1,
+		PollInterval: time.Hour,
+		Lease:        time.Hour,
+		Logger:       logging.Discard(),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(stopped)
+	}()
+
+	select {
+	case <-executed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("action was not executed")
+	}
+	cancel()
+	<-stopped
+
+	if record := store.record(1); record.Status != execute.ActionRunning || record.WorkerID != "other-worker" {
+		t.Errorf("action %s by %q, want still running by other-worker", record.Status, record.WorkerID)
+	}
+}
+
+func TestWorkerPool_ShutdownHandsBackAction(t *testing.T) {
+	store := &fakeActionStore{}
+	store.Enqueue(context.Background(), &execute.Action{HostID: "host-1", Type: execute.ActionReplaceHost})
+
+	started := make(chan struct{})
+	executor := executorFunc(func(ctx context.Context, action *execute.Action) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	pool := execute.NewWorkerPool(store, executor, execute.WorkerPoolConfig{
+		Size:         1,
+		PollInterval: time.Hour,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(stopped)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("action was not started")
+	}
+	cancel()
+	<-stopped
+
+	record := store.record(1)
+	if record.Status != execute.ActionPending || record.Attempts != 0 {
+		t.Errorf("action status = %s after %d attempts, want pending after 0", record.Status, record.Attempts)
+	}
+	if record.NotBefore.After(time.Now()) {
+		t.Errorf("action not before %v, want it claimable right away", record.NotBefore)
+	}
+}
+
+func TestWorkerPool_DeadAfterRepeatedLeaseExpiry(t *testing.T) {
+	store := &fakeActionStore{}
+	store.Enqueue(context.Background(), &execute.Action{HostID: "host-1", Type: execute.ActionDrainHost})
+
+	// simulate workers dying mid-action until the policy is used up
+	for range 3 {
+		if _, err := store.Next(context.Background(), "crashed", time.Nanosecond); err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+		if n, _ := store.ReclaimExpired(context.Background()); n != 1 {
+			t.Fatalf("ReclaimExpired() = %d, want 1", n)
+		}
+	}
+
+	pool := execute.NewWorkerPool(store, executorFunc(func(context.Context, *execute.Action) error {
+		t.Errorf("executor called for an action whose attempts are exhausted")
+		return nil
+	}), execute.WorkerPoolConfig{
+		Size:         1,
+		PollInterval: time.Millisecond,
+		RetryPolicies: map[execute.ActionType]execute.RetryPolicy{
+			execute.ActionDrainHost: {MaxAttempts: 3},
+		},
+	})
+	runUntilFinished(t, pool, store, 1)
+
+	if status := store.record(1).Status; status != execute.ActionDead {
+		t.Errorf("action status = %s, want %s", status, execute.ActionDead)
+	}
+}
+
+type gateFunc func(ctx context.Context, record *execute.ActionRecord) error
+
+func (f gateFunc) Admit(ctx context.Context, record *execute.ActionRecord) error {
+	return f(ctx, record)
+}
+
+func TestWorkerPool_Gate(t *testing.T) {
+	store := &fakeActionStore{}
+	store.Enqueue(context.Background(), &execute.Action{HostID: "host-1", Type: execute.ActionDrainHost})
+
+	var mu sync.Mutex
+	admitted := false
+	gate := gateFunc(func(ctx context.Context, record *execute.ActionRecord) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !admitted {
+			admitted = true
+			return errors.New("budget exhausted")
+		}
+		return nil
+	})
+
+	executed := 0
+	pool := execute.NewWorkerPool(store, executorFunc(func(context.Context, *execute.Action) error {
+		executed++
+		return nil
+	}), execute.WorkerPoolConfig{
+		Size:            1,
+		PollInterval:    time.Millisecond,
+		MaxPollInterval: time.Millisecond,
+		Gate:            gate,
+	})
+	runUntilFinished(t, pool, store, 1)
+
+	record := store.record(1)
+	if record.Status != execute.ActionDone || record.Attempts != 1 || executed != 1 {
+		t.Errorf("action status = %s after %d attempts and %d executions, want done after 1", record.Status, record.Attempts, executed)
+	}
+	if record.LastError == "" {
+		t.Errorf("blocked action has no last error")
+	}
+}
@@ -0,0 +1,34 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+func setETag(w http.ResponseWriter, host *api.Host) {
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(host.Version, 10)))
+}
+
+// ifMatchVersion returns the host version required by the request's If-Match
+// header, or 0 if the request is unconditional.
+func ifMatchVersion(r *http.Request) (int64, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return 0, nil
+	}
+
+	unquoted, err := strconv.Unquote(v)
+	if err != nil {
+		unquoted = v
+	}
+
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid If-Match header %q", v)
+	}
+	return version, nil
+}
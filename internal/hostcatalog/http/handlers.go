@@ -2,33 +2,152 @@ package http
 
 import (
 	"encoding/json"
+	"log/slog"
+	"net/http"
+
 	"github.com/nabutabu/crane-oss/internal/hostcatalog/service"
 	"github.com/nabutabu/crane-oss/pkg/api"
-	"net/http"
 )
 
 type Handler struct {
 	catalog *service.HostCatalogService
+	// Logger defaults to slog.Default.
+	Logger *slog.Logger
+}
+
+func NewHandler(catalog *service.HostCatalogService) *Handler {
+	return &Handler{catalog: catalog}
+}
+
+func (h *Handler) logger() *slog.Logger {
+	if h.Logger == nil {
+		return slog.Default()
+	}
+	return h.Logger
+}
+
+// Register mounts the host catalog routes on mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	handle(mux, "POST /v1/hosts", h.CreateHost)
+	handle(mux, "GET /v1/hosts", h.ListHosts)
+	handle(mux, "GET /v1/hosts/{id}", h.GetHost)
+	handle(mux, "DELETE /v1/hosts/{id}", h.DeleteHost)
+	handle(mux, "GET /v1/hosts/{id}/history", h.History)
+	handle(mux, "POST /v1/hosts/{id}/transitions", h.TransitionState)
+	handle(mux, "POST /v1/hosts/{id}/health", h.TransitionHealth)
 }
 
+func (h *Handler) CreateHost(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var host api.Host
+	if err := json.NewDecoder(r.Body).Decode(&host); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := h.catalog.RegisterHost(ctx, &host)
+	if err != nil {
+		writeError(h.logger(), w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/v1/hosts/"+created.ID)
+	setETag(w, created)
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) GetHost(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	host, err := h.catalog.GetHost(ctx, r.PathValue("id"))
+	if err != nil {
+		writeError(h.logger(), w, r, err)
+		return
+	}
+
+	setETag(w, host)
+	writeJSON(w, http.StatusOK, host)
+}
+
+func (h *Handler) ListHosts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	query, err := parseHostQuery(r.URL.Query())
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.catalog.ListHosts(ctx, query)
+	if err != nil {
+		writeError(h.logger(), w, r, err)
+		return
+	}
+
+	hosts := page.Hosts
+	if hosts == nil {
+		hosts = []*api.Host{}
+	}
+
+	writeJSON(w, http.StatusOK, api.HostList{Hosts: hosts, NextCursor: page.NextCursor})
+}
+
+func (h *Handler) DeleteHost(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	err := h.catalog.DecommissionHost(ctx, r.PathValue("id"))
+	if err != nil {
+		writeError(h.logger(), w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) History(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	events, err := h.catalog.History(ctx, r.PathValue("id"))
+	if err != nil {
+		writeError(h.logger(), w, r, err)
+		return
+	}
+
+	if events == nil {
+		events = []*api.HostEvent{}
+	}
+
+	writeJSON(w, http.StatusOK, api.HostHistory{Events: events})
+}
+
+// TransitionState moves a host to the state in the request body and responds
+// with the updated host.
 func (h *Handler) TransitionState(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	id := r.PathValue("id")
-	newState := r.Header.Get("X-New-State")
 
-	if id == "" || newState == "" {
-		http.Error(w, "missing id or state", http.StatusBadRequest)
+	var req api.TransitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	err := h.catalog.TransitionState(ctx, id, newState)
+	version, err := ifMatchVersion(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	host, err := h.catalog.TransitionState(ctx, id, string(req.To), version, req.ChangeInfo)
+	if err != nil {
+		writeError(h.logger(), w, r, err)
+		return
+	}
+
+	setETag(w, host)
+	writeJSON(w, http.StatusOK, host)
 }
 
 func (h *Handler) TransitionHealth(w http.ResponseWriter, r *http.Request) {
@@ -42,20 +161,26 @@ func (h *Handler) TransitionHealth(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&data)
 	if err != nil {
 		// Handle errors (e.g., malformed JSON, wrong field types)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	if id == "" || data.Health == "" {
-		http.Error(w, "missing id or state", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, "missing id or state")
 		return
 	}
 
-	err = h.catalog.TransitionHealth(ctx, id, data.Health)
+	err = h.catalog.TransitionHealth(ctx, id, data.Health, data.ChangeInfo)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(h.logger(), w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
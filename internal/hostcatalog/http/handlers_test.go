@@ -0,0 +1,241 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cataloghttp "github.com/nabutabu/crane-oss/internal/hostcatalog/http"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/service"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/pkg/api"
+	"github.com/nabutabu/crane-oss/pkg/reconcile"
+)
+
+func newServer(t *testing.T, hosts ...*api.Host) *http.ServeMux {
+	t.Helper()
+
+	s := store.NewMemoryHostStore()
+	for _, h := range hosts {
+		if err := s.Create(context.Background(), h); err != nil {
+			t.Fatalf("Create(%s) failed: %v", h.ID, err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	cataloghttp.NewHandler(service.NewHostCatalogService(s)).Register(mux)
+	return mux
+}
+
+func TestHandler_ErrorStatus(t *testing.T) {
+	mux := newServer(t,
+		&api.Host{ID: "ready", State: api.HostReady},
+	)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     map[string]string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "missing host",
+			method:     http.MethodGet,
+			path:       "/v1/hosts/missing",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "illegal transition",
+			method:     http.MethodPost,
+			path:       "/v1/hosts/ready/transitions",
+			body:       `{"to": "PROVISIONING"}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "stale If-Match",
+			method:     http.MethodPost,
+			path:       "/v1/hosts/ready/transitions",
+			header:     map[string]string{"If-Match": `"9"`},
+			body:       `{"to": "DRAINING"}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "unknown state",
+			method:     http.MethodPost,
+			path:       "/v1/hosts/ready/transitions",
+			body:       `{"to": "ON_FIRE"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "missing target state",
+			method:     http.MethodPost,
+			path:       "/v1/hosts/ready/transitions",
+			body:       `{"reason": "because"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "host without required fields",
+			method:     http.MethodPost,
+			path:       "/v1/hosts",
+			body:       `{"zone": "us-west-2a"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "malformed body",
+			method:     http.MethodPost,
+			path:       "/v1/hosts",
+			body:       `{`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "deleting a live host",
+			method:     http.MethodDelete,
+			path:       "/v1/hosts/ready",
+			wantStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", ct)
+			}
+
+			var problem api.Problem
+			if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+				t.Fatalf("decoding problem: %v", err)
+			}
+			if problem.Status != tt.wantStatus || problem.Title == "" {
+				t.Errorf("problem = %+v", problem)
+			}
+		})
+	}
+}
+
+func TestHandler_HostLifecycle(t *testing.T) {
+	mux := newServer(t)
+
+	do := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/v1/hosts", `{"id": "host-1", "role": {"name": "worker"}, "zone": "z", "image_id": "ami"}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("ETag") != `"1"` {
+		t.Errorf("create ETag = %q, want \"1\"", rec.Header().Get("ETag"))
+	}
+
+	rec = do(http.MethodPost, "/v1/hosts/host-1/transitions",
+		`{"to": "READY", "reason": "bootstrapped", "actor": "provisioner"}`,
+		map[string]string{"If-Match": `"1"`})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("transition status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("ETag") != `"2"` {
+		t.Errorf("transition ETag = %q, want \"2\"", rec.Header().Get("ETag"))
+	}
+	var updated api.Host
+	if err := json.NewDecoder(rec.Body).Decode(&updated); err != nil {
+		t.Fatalf("decoding host: %v", err)
+	}
+	if updated.State != api.HostReady || updated.Version != 2 {
+		t.Errorf("transition returned %s@%d, want READY@2", updated.State, updated.Version)
+	}
+
+	rec = do(http.MethodGet, "/v1/hosts/host-1/history", "", nil)
+	var history api.HostHistory
+	if err := json.NewDecoder(rec.Body).Decode(&history); err != nil {
+		t.Fatalf("decoding history: %v", err)
+	}
+	if len(history.Events) != 1 || history.Events[0].Actor != "provisioner" || history.Events[0].Reason != "bootstrapped" {
+		t.Errorf("history = %+v", history.Events)
+	}
+
+	rec = do(http.MethodGet, "/v1/hosts?state=READY", "", nil)
+	var list api.HostList
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("decoding list: %v", err)
+	}
+	if len(list.Hosts) != 1 || list.Hosts[0].ID != "host-1" {
+		t.Errorf("list = %+v", list)
+	}
+}
+
+type planFunc func(ctx context.Context) (*reconcile.Plan, error)
+
+func (f planFunc) Plan(ctx context.Context) (*reconcile.Plan, error) {
+	return f(ctx)
+}
+
+func TestPlanHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		planner    planFunc
+		wantStatus int
+		wantHosts  int
+	}{
+		{
+			name: "plan",
+			planner: func(context.Context) (*reconcile.Plan, error) {
+				return &reconcile.Plan{Hosts: 2, Actions: []reconcile.PlannedAction{{HostID: "host-1"}}}, nil
+			},
+			wantStatus: http.StatusOK,
+			wantHosts:  2,
+		},
+		{
+			name: "catalog unavailable",
+			planner: func(context.Context) (*reconcile.Plan, error) {
+				return nil, api.ErrUnavailable
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			cataloghttp.NewPlanHandler(tt.planner).Register(mux)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/reconcile/plan", nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var plan reconcile.Plan
+			if err := json.NewDecoder(rec.Body).Decode(&plan); err != nil {
+				t.Fatalf("decode plan: %v", err)
+			}
+			if plan.Hosts != tt.wantHosts || len(plan.Actions) != 1 {
+				t.Errorf("plan = %+v", plan)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package http
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/nabutabu/crane-oss/pkg/reconcile"
+)
+
+// Planner computes what a reconcile would do without doing it.
+type Planner interface {
+	Plan(ctx context.Context) (*reconcile.Plan, error)
+}
+
+type PlanHandler struct {
+	planner Planner
+	// Logger defaults to slog.Default.
+	Logger *slog.Logger
+}
+
+func NewPlanHandler(planner Planner) *PlanHandler {
+	return &PlanHandler{planner: planner}
+}
+
+func (h *PlanHandler) logger() *slog.Logger {
+	if h.Logger == nil {
+		return slog.Default()
+	}
+	return h.Logger
+}
+
+// Register mounts the reconcile plan route on mux.
+func (h *PlanHandler) Register(mux *http.ServeMux) {
+	handle(mux, "GET /v1/reconcile/plan", h.Plan)
+}
+
+func (h *PlanHandler) Plan(w http.ResponseWriter, r *http.Request) {
+	plan, err := h.planner.Plan(r.Context())
+	if err != nil {
+		writeError(h.logger(), w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, plan)
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+// writeProblem responds with an RFC 7807 problem details body.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(api.Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	})
+}
+
+// writeError maps an error from the catalog to a status code. Unexpected
+// errors are logged to logger and reported without detail so internals do
+// not leak to clients.
+func writeError(logger *slog.Logger, w http.ResponseWriter, r *http.Request, err error) {
+	status := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		logger.ErrorContext(r.Context(), "request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+	}
+
+	detail := err.Error()
+	if status == http.StatusInternalServerError {
+		detail = ""
+	}
+
+	writeProblem(w, r, status, detail)
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrInvalidCursor):
+		return http.StatusBadRequest
+	case errors.Is(err, api.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, api.ErrConflict), errors.Is(err, api.ErrInvalidTransition):
+		return http.StatusConflict
+	case errors.Is(err, api.ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, api.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+// parseHostQuery builds a store.HostQuery from the list endpoint's query
+// parameters. Filters may be repeated or comma separated, e.g.
+// ?state=READY,DRAINING&zone=us-west-2a.
+func parseHostQuery(values url.Values) (store.HostQuery, error) {
+	var q store.HostQuery
+
+	for _, s := range listParam(values, "state") {
+		state := api.HostState(strings.ToUpper(s))
+		if !state.Valid() {
+			return q, fmt.Errorf("unknown state %q", s)
+		}
+		q.States = append(q.States, state)
+	}
+
+	for _, s := range listParam(values, "health") {
+		health := api.HostHealth(strings.ToLower(s))
+		if !health.Valid() {
+			return q, fmt.Errorf("unknown health %q", s)
+		}
+		q.Health = append(q.Health, health)
+	}
+
+	q.Roles = listParam(values, "role")
+	q.Zones = listParam(values, "zone")
+	q.Fleets = listParam(values, "fleet")
+	q.ImageIDs = listParam(values, "image_id")
+
+	var err error
+	if q.CreatedAfter, err = timeParam(values, "created_after"); err != nil {
+		return q, err
+	}
+	if q.CreatedBefore, err = timeParam(values, "created_before"); err != nil {
+		return q, err
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > store.MaxPageSize {
+			return q, fmt.Errorf("limit must be between 1 and %d", store.MaxPageSize)
+		}
+		q.Limit = limit
+	}
+
+	q.Cursor = values.Get("cursor")
+
+	return q, nil
+}
+
+func listParam(values url.Values, key string) []string {
+	var out []string
+	for _, v := range values[key] {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+func timeParam(values url.Values, key string) (time.Time, error) {
+	v := values.Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+	}
+	return t, nil
+}
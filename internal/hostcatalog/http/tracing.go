@@ -0,0 +1,42 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/nabutabu/crane-oss/internal/httputil"
+	"github.com/nabutabu/crane-oss/internal/logging"
+	"github.com/nabutabu/crane-oss/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/nabutabu/crane-oss/internal/hostcatalog/http")
+
+// handle mounts fn on mux under pattern and traces every request it serves.
+// Callers that send a traceparent header get their trace continued.
+func handle(mux *http.ServeMux, pattern string, fn http.HandlerFunc) {
+	mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, pattern,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(pattern),
+				semconv.URLPath(r.URL.Path),
+				tracing.KeyRequestID.String(logging.RequestID(ctx)),
+			),
+		)
+		defer span.End()
+
+		rec := httputil.NewStatusRecorder(w)
+		fn(rec, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.Status))
+		if rec.Status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.Status))
+		}
+	}))
+}
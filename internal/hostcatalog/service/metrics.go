@@ -0,0 +1,11 @@
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var hostTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "crane_host_transitions_total",
+	Help: "Host state transitions, by the state left and the state entered.",
+}, []string{"from", "to"})
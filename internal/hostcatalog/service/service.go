@@ -2,19 +2,67 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"log/slog"
 	"slices"
+	"time"
 
 	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/internal/logging"
+	"github.com/nabutabu/crane-oss/internal/tracing"
 	"github.com/nabutabu/crane-oss/pkg/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/nabutabu/crane-oss/internal/hostcatalog/service")
+
+var ErrHostNotTerminated = fmt.Errorf("host must be TERMINATED before it can be deleted: %w", api.ErrConflict)
+
+// healthPolicyActor is recorded as the actor of transitions made by the
+// health policy on behalf of a health report.
+const healthPolicyActor = "crane/health-policy"
+
+// maxHealthPolicyAttempts bounds how often the health policy re-reads a host
+// whose state changed underneath it.
+const maxHealthPolicyAttempts = 3
+
 type HostCatalogService struct {
-	store store.PostgresHostStore
+	store             store.HostStore
+	healthDrivesState bool
+	logger            *slog.Logger
+}
+
+type Option func(*HostCatalogService)
+
+// WithHealthDrivenState makes health reports drive the lifecycle: a READY
+// host reported unhealthy moves to UNHEALTHY, and an UNHEALTHY host reported
+// healthy again moves back to READY. The moves go through the same transition
+// rules as TransitionState.
+func WithHealthDrivenState() Option {
+	return func(service *HostCatalogService) {
+		service.healthDrivesState = true
+	}
+}
+
+// WithLogger replaces slog.Default as the logger catalog changes are logged
+// to.
+func WithLogger(logger *slog.Logger) Option {
+	return func(service *HostCatalogService) {
+		service.logger = logger
+	}
 }
 
-func NewHostCatalogService(store store.PostgresHostStore) *HostCatalogService {
-	return &HostCatalogService{store: store}
+func NewHostCatalogService(store store.HostStore, opts ...Option) *HostCatalogService {
+	service := &HostCatalogService{store: store, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(service)
+	}
+	return service
 }
 
 func GetValidNextStates(currState api.HostState) []api.HostState {
@@ -34,33 +82,237 @@ func GetValidNextStates(currState api.HostState) []api.HostState {
 	return []api.HostState{}
 }
 
+// TransitionState moves a host to newState if that is a legal transition from
+// its current state and records who made the change and why. If
+// expectedVersion is non-zero the host must still be at that version. The
+// write itself is a compare-and-swap against the version that was validated,
+// so concurrent transitions fail with api.ErrConflict instead of producing an
+// illegal sequence.
 func (service *HostCatalogService) TransitionState(
 	ctx context.Context,
 	id string,
 	newState string,
-) error {
+	expectedVersion int64,
+	change api.ChangeInfo,
+) (_ *api.Host, err error) {
+	ctx, span := tracer.Start(ctx, "HostCatalogService.TransitionState", trace.WithAttributes(tracing.KeyHostID.String(id), attribute.String("to", newState)))
+	defer func() { tracing.End(span, err) }()
+
+	// convert newState to api.HostState
+	state := api.HostState(newState)
+	if !state.Valid() {
+		return nil, fmt.Errorf("unknown state %q: %w", newState, api.ErrValidation)
+	}
+
 	// 1. load host
 	host, err := service.store.GetByID(ctx, id)
 	if err != nil {
-		return errors.New("Host not found")
+		return nil, err
 	}
 
-	// convert newState to api.HostState
-	state := api.HostState(newState)
+	if expectedVersion != 0 && host.Version != expectedVersion {
+		return nil, fmt.Errorf("host %q is at version %d, not %d: %w", id, host.Version, expectedVersion, api.ErrConflict)
+	}
 
 	// 2. validate transition
 	validNextStates := GetValidNextStates(host.State)
 	if !slices.Contains(validNextStates, state) {
-		return errors.New("Not a valid next state")
+		return nil, fmt.Errorf("%w: %s -> %s", api.ErrInvalidTransition, host.State, state)
 	}
 
 	// 3. update new state
-	return service.store.UpdateState(ctx, id, state)
+	if err := service.store.UpdateState(ctx, id, state, host.Version, change); err != nil {
+		return nil, err
+	}
+	hostTransitions.WithLabelValues(string(host.State), string(state)).Inc()
+	service.logger.InfoContext(ctx, "host state changed",
+		logging.KeyHostID, id,
+		"from", host.State,
+		"to", state,
+		"actor", change.Actor,
+		"reason", change.Reason,
+	)
+
+	host.State = state
+	host.Version++
+	return host, nil
 }
 
-func (service *HostCatalogService) TransitionHealth(ctx context.Context, id string, newHealth string) error {
-	// convert newState to api.HostState
+func (service *HostCatalogService) TransitionHealth(ctx context.Context, id string, newHealth string, change api.ChangeInfo) (err error) {
+	ctx, span := tracer.Start(ctx, "HostCatalogService.TransitionHealth", trace.WithAttributes(tracing.KeyHostID.String(id), attribute.String("health", newHealth)))
+	defer func() { tracing.End(span, err) }()
+
+	// convert newHealth to api.HostHealth
 	health := api.HostHealth(newHealth)
+	if !health.Valid() {
+		return fmt.Errorf("unknown health %q: %w", newHealth, api.ErrValidation)
+	}
+
+	if err := service.store.UpdateHealth(ctx, id, health, change); err != nil {
+		return err
+	}
+	service.logger.DebugContext(ctx, "host health reported",
+		logging.KeyHostID, id,
+		"health", health,
+		"actor", change.Actor,
+	)
+
+	if !service.healthDrivesState {
+		return nil
+	}
+
+	return service.applyHealthPolicy(ctx, id, health, change)
+}
+
+// healthTarget returns the state a host in state should move to after
+// reporting health, or "" if it should stay where it is.
+func healthTarget(state api.HostState, health api.HostHealth) api.HostState {
+	switch {
+	case state == api.HostReady && health == api.HostHealthUnhealthy:
+		return api.HostUnhealthy
+	case state == api.HostUnhealthy && health == api.HostHealthHealthy:
+		return api.HostReady
+	}
+	return ""
+}
+
+func (service *HostCatalogService) applyHealthPolicy(ctx context.Context, id string, health api.HostHealth, change api.ChangeInfo) error {
+	reason := fmt.Sprintf("health reported %s", health)
+	if change.Actor != "" {
+		reason += " by " + change.Actor
+	}
+	if change.Reason != "" {
+		reason += ": " + change.Reason
+	}
+
+	var err error
+	for range maxHealthPolicyAttempts {
+		var host *api.Host
+		host, err = service.store.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		target := healthTarget(host.State, health)
+		if target == "" || !slices.Contains(GetValidNextStates(host.State), target) {
+			return nil
+		}
 
-	return service.store.UpdateHealth(ctx, id, health)
+		err = service.store.UpdateState(ctx, id, target, host.Version, api.ChangeInfo{
+			Actor:  healthPolicyActor,
+			Reason: reason,
+		})
+		if err == nil {
+			hostTransitions.WithLabelValues(string(host.State), string(target)).Inc()
+			service.logger.InfoContext(ctx, "host state changed",
+				logging.KeyHostID, id,
+				"from", host.State,
+				"to", target,
+				"actor", healthPolicyActor,
+				"reason", reason,
+			)
+		}
+		if !errors.Is(err, api.ErrConflict) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// History returns the recorded state and health changes of a host, oldest
+// first. History is kept after a host has been decommissioned.
+func (service *HostCatalogService) History(ctx context.Context, id string) (_ []*api.HostEvent, err error) {
+	ctx, span := tracer.Start(ctx, "HostCatalogService.History", trace.WithAttributes(tracing.KeyHostID.String(id)))
+	defer func() { tracing.End(span, err) }()
+
+	events, err := service.store.History(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(events) == 0 {
+		// distinguish a host without history from one that never existed
+		if _, err := service.store.GetByID(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+// RegisterHost adds a new host to the catalog. Hosts always enter the
+// catalog in PROVISIONING with unknown health; an ID is generated when the
+// caller does not supply one.
+func (service *HostCatalogService) RegisterHost(ctx context.Context, host *api.Host) (_ *api.Host, err error) {
+	ctx, span := tracer.Start(ctx, "HostCatalogService.RegisterHost")
+	defer func() { tracing.End(span, err) }()
+
+	if host.Role.Name == "" || host.Zone == "" || host.ImageID == "" {
+		return nil, fmt.Errorf("role, zone and image_id are required: %w", api.ErrValidation)
+	}
+
+	if host.ID == "" {
+		id, err := newHostID()
+		if err != nil {
+			return nil, err
+		}
+		host.ID = id
+	}
+	span.SetAttributes(tracing.KeyHostID.String(host.ID))
+
+	host.State = api.HostProvisioning
+	host.Health = api.HostHealthUnknown
+	host.CreatedAt = time.Now().UTC()
+
+	if err := service.store.Create(ctx, host); err != nil {
+		return nil, err
+	}
+	service.logger.InfoContext(ctx, "host registered", logging.KeyHostID, host.ID)
+
+	return host, nil
+}
+
+func (service *HostCatalogService) GetHost(ctx context.Context, id string) (_ *api.Host, err error) {
+	ctx, span := tracer.Start(ctx, "HostCatalogService.GetHost", trace.WithAttributes(tracing.KeyHostID.String(id)))
+	defer func() { tracing.End(span, err) }()
+
+	return service.store.GetByID(ctx, id)
+}
+
+func (service *HostCatalogService) ListHosts(ctx context.Context, query store.HostQuery) (_ *store.HostPage, err error) {
+	ctx, span := tracer.Start(ctx, "HostCatalogService.ListHosts")
+	defer func() { tracing.End(span, err) }()
+
+	return service.store.List(ctx, query)
+}
+
+// DecommissionHost removes a host from the catalog. Only TERMINATED hosts
+// can be removed; anything else has to be drained first.
+func (service *HostCatalogService) DecommissionHost(ctx context.Context, id string) (err error) {
+	ctx, span := tracer.Start(ctx, "HostCatalogService.DecommissionHost", trace.WithAttributes(tracing.KeyHostID.String(id)))
+	defer func() { tracing.End(span, err) }()
+
+	host, err := service.store.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if host.State != api.HostTerminated {
+		return ErrHostNotTerminated
+	}
+
+	if err := service.store.Delete(ctx, id); err != nil {
+		return err
+	}
+	service.logger.InfoContext(ctx, "host decommissioned", logging.KeyHostID, id)
+	return nil
+}
+
+func newHostID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "host-" + hex.EncodeToString(b), nil
 }
@@ -0,0 +1,290 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/service"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+func newService(t *testing.T, hosts ...*api.Host) (*service.HostCatalogService, *store.MemoryHostStore) {
+	t.Helper()
+
+	s := store.NewMemoryHostStore()
+	for _, h := range hosts {
+		if err := s.Create(context.Background(), h); err != nil {
+			t.Fatalf("Create(%s) failed: %v", h.ID, err)
+		}
+	}
+	return service.NewHostCatalogService(s), s
+}
+
+func TestHostCatalogService_TransitionState(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    api.HostState
+		to      api.HostState
+		wantErr bool
+	}{
+		{name: "provisioning to ready", from: api.HostProvisioning, to: api.HostReady},
+		{name: "ready to draining", from: api.HostReady, to: api.HostDraining},
+		{name: "draining to terminated", from: api.HostDraining, to: api.HostTerminated},
+		{name: "provisioning to draining is rejected", from: api.HostProvisioning, to: api.HostDraining, wantErr: true},
+		{name: "terminated is final", from: api.HostTerminated, to: api.HostReady, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			svc, s := newService(t, &api.Host{ID: "host-1", State: tt.from})
+
+			_, err := svc.TransitionState(ctx, "host-1", string(tt.to), 0, api.ChangeInfo{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TransitionState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			want := tt.to
+			if tt.wantErr {
+				want = tt.from
+			}
+			got, _ := s.GetByID(ctx, "host-1")
+			if got.State != want {
+				t.Errorf("state = %s, want %s", got.State, want)
+			}
+		})
+	}
+
+	t.Run("missing host", func(t *testing.T) {
+		svc, _ := newService(t)
+		if _, err := svc.TransitionState(context.Background(), "missing", string(api.HostReady), 0, api.ChangeInfo{}); err == nil {
+			t.Fatalf("TransitionState() on a missing host succeeded")
+		}
+	})
+}
+
+func TestHostCatalogService_TransitionState_Version(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newService(t, &api.Host{ID: "host-1", State: api.HostReady})
+
+	if _, err := svc.TransitionState(ctx, "host-1", string(api.HostDraining), 7, api.ChangeInfo{}); !errors.Is(err, api.ErrConflict) {
+		t.Fatalf("TransitionState() with a stale If-Match error = %v, want api.ErrConflict", err)
+	}
+
+	host, err := svc.TransitionState(ctx, "host-1", string(api.HostDraining), 1, api.ChangeInfo{})
+	if err != nil {
+		t.Fatalf("TransitionState() failed: %v", err)
+	}
+	if host.State != api.HostDraining || host.Version != 2 {
+		t.Errorf("TransitionState() = %s@%d, want DRAINING@2", host.State, host.Version)
+	}
+}
+
+// Two callers that validated against the same snapshot must not both win.
+func TestHostCatalogService_TransitionState_Race(t *testing.T) {
+	ctx := context.Background()
+	svc, s := newService(t, &api.Host{ID: "host-1", State: api.HostReady})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, to := range []api.HostState{api.HostDraining, api.HostUnhealthy} {
+		wg.Go(func() {
+			_, errs[i] = svc.TransitionState(ctx, "host-1", string(to), 1, api.ChangeInfo{})
+		})
+	}
+	wg.Wait()
+
+	if (errs[0] == nil) == (errs[1] == nil) {
+		t.Fatalf("expected exactly one transition to succeed, got %v and %v", errs[0], errs[1])
+	}
+
+	host, _ := s.GetByID(ctx, "host-1")
+	if host.Version != 2 {
+		t.Errorf("Version = %d, want 2", host.Version)
+	}
+}
+
+func TestHostCatalogService_History(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newService(t,
+		&api.Host{ID: "host-1", State: api.HostReady, Health: api.HostHealthHealthy},
+		&api.Host{ID: "quiet", State: api.HostReady},
+	)
+
+	change := api.ChangeInfo{Actor: "oncall@example.com", Reason: "kernel upgrade"}
+	if _, err := svc.TransitionState(ctx, "host-1", string(api.HostDraining), 0, change); err != nil {
+		t.Fatalf("TransitionState() failed: %v", err)
+	}
+	if err := svc.TransitionHealth(ctx, "host-1", string(api.HostHealthUnhealthy), api.ChangeInfo{Actor: "agent"}); err != nil {
+		t.Fatalf("TransitionHealth() failed: %v", err)
+	}
+
+	events, err := svc.History(ctx, "host-1")
+	if err != nil {
+		t.Fatalf("History() failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("History() returned %d events, want 2", len(events))
+	}
+
+	first := events[0]
+	if first.Field != api.HostEventState || first.OldValue != "READY" || first.NewValue != "DRAINING" ||
+		first.Actor != change.Actor || first.Reason != change.Reason {
+		t.Errorf("first event = %+v", first)
+	}
+	if events[1].Field != api.HostEventHealth || events[1].NewValue != "unhealthy" {
+		t.Errorf("second event = %+v", events[1])
+	}
+
+	if events, err := svc.History(ctx, "quiet"); err != nil || len(events) != 0 {
+		t.Errorf("History(quiet) = %v, %v; want no events", events, err)
+	}
+	if _, err := svc.History(ctx, "missing"); err == nil {
+		t.Errorf("History() of a missing host succeeded")
+	}
+}
+
+func TestHostCatalogService_RegisterHost(t *testing.T) {
+	ctx := context.Background()
+	svc, s := newService(t)
+
+	host, err := svc.RegisterHost(ctx, &api.Host{
+		Role:    api.Role{Name: "worker"},
+		Zone:    "us-west-2a",
+		ImageID: "ami-123",
+		State:   api.HostReady,
+	})
+	if err != nil {
+		t.Fatalf("RegisterHost() failed: %v", err)
+	}
+
+	if host.ID == "" {
+		t.Errorf("RegisterHost() did not assign an id")
+	}
+	if host.State != api.HostProvisioning || host.Health != api.HostHealthUnknown {
+		t.Errorf("RegisterHost() = %s/%s, want PROVISIONING/unknown", host.State, host.Health)
+	}
+	if host.CreatedAt.IsZero() {
+		t.Errorf("RegisterHost() did not set CreatedAt")
+	}
+
+	if _, err := s.GetByID(ctx, host.ID); err != nil {
+		t.Errorf("registered host was not stored: %v", err)
+	}
+}
+
+func TestHostCatalogService_DecommissionHost(t *testing.T) {
+	ctx := context.Background()
+	svc, s := newService(t,
+		&api.Host{ID: "ready", State: api.HostReady},
+		&api.Host{ID: "terminated", State: api.HostTerminated},
+	)
+
+	if err := svc.DecommissionHost(ctx, "ready"); err != service.ErrHostNotTerminated {
+		t.Errorf("DecommissionHost(ready) error = %v, want %v", err, service.ErrHostNotTerminated)
+	}
+
+	if err := svc.DecommissionHost(ctx, "terminated"); err != nil {
+		t.Fatalf("DecommissionHost(terminated) failed: %v", err)
+	}
+	if _, err := s.GetByID(ctx, "terminated"); err == nil {
+		t.Errorf("decommissioned host is still in the store")
+	}
+}
+
+func TestHostCatalogService_TransitionHealth(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []service.Option
+		state     api.HostState
+		health    api.HostHealth
+		report    string
+		wantState api.HostState
+		wantErr   error
+	}{
+		{
+			name:    "rejects unknown health",
+			state:   api.HostReady,
+			health:  api.HostHealthHealthy,
+			report:  "banana",
+			wantErr: api.ErrValidation,
+		},
+		{
+			name:      "health alone does not move state by default",
+			state:     api.HostReady,
+			health:    api.HostHealthHealthy,
+			report:    "unhealthy",
+			wantState: api.HostReady,
+		},
+		{
+			name:      "ready host reported unhealthy becomes UNHEALTHY",
+			opts:      []service.Option{service.WithHealthDrivenState()},
+			state:     api.HostReady,
+			health:    api.HostHealthHealthy,
+			report:    "unhealthy",
+			wantState: api.HostUnhealthy,
+		},
+		{
+			name:      "unhealthy host that recovers becomes READY",
+			opts:      []service.Option{service.WithHealthDrivenState()},
+			state:     api.HostUnhealthy,
+			health:    api.HostHealthUnhealthy,
+			report:    "healthy",
+			wantState: api.HostReady,
+		},
+		{
+			name:      "draining host stays draining",
+			opts:      []service.Option{service.WithHealthDrivenState()},
+			state:     api.HostDraining,
+			health:    api.HostHealthHealthy,
+			report:    "unhealthy",
+			wantState: api.HostDraining,
+		},
+		{
+			name:      "provisioning host is not marked unhealthy",
+			opts:      []service.Option{service.WithHealthDrivenState()},
+			state:     api.HostProvisioning,
+			health:    api.HostHealthUnknown,
+			report:    "unhealthy",
+			wantState: api.HostProvisioning,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := store.NewMemoryHostStore()
+			if err := s.Create(ctx, &api.Host{ID: "host-1", State: tt.state, Health: tt.health}); err != nil {
+				t.Fatalf("Create() failed: %v", err)
+			}
+			svc := service.NewHostCatalogService(s, tt.opts...)
+
+			err := svc.TransitionHealth(ctx, "host-1", tt.report, api.ChangeInfo{Actor: "agent"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TransitionHealth() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			host, _ := s.GetByID(ctx, "host-1")
+			if host.State != tt.wantState {
+				t.Errorf("state = %s, want %s", host.State, tt.wantState)
+			}
+			if host.Health != api.HostHealth(tt.report) {
+				t.Errorf("health = %s, want %s", host.Health, tt.report)
+			}
+
+			if tt.wantState != tt.state {
+				events, _ := s.History(ctx, "host-1")
+				last := events[len(events)-1]
+				if last.Field != api.HostEventState || last.Actor != "crane/health-policy" {
+					t.Errorf("policy transition recorded as %+v", last)
+				}
+			}
+		})
+	}
+}
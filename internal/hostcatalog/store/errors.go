@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/lib/pq"
+
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+// dbError translates database/sql and driver errors into the api error model
+// so that callers never have to know which database backs the catalog.
+func dbError(id string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound(id)
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "23505": // unique_violation
+			return fmt.Errorf("host %q already exists: %w", id, api.ErrConflict)
+		case pqErr.Code.Class() == "08", // connection_exception
+			pqErr.Code.Class() == "53", // insufficient_resources
+			pqErr.Code.Class() == "57": // operator_intervention, e.g. admin_shutdown
+			return fmt.Errorf("%w: %w", api.ErrUnavailable, err)
+		}
+		return err
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr) {
+		return fmt.Errorf("%w: %w", api.ErrUnavailable, err)
+	}
+
+	return err
+}
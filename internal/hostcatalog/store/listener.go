@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	listenerMinReconnect = time.Second
+	listenerMaxReconnect = time.Minute
+	// listenerPingInterval is how often an idle listener checks its
+	// connection, so that a dead one is noticed and re-established.
+	listenerPingInterval = 90 * time.Second
+)
+
+// HostListener reports hosts whose state or health changed, as published on
+// HostChangesChannel by PostgresHostStore. It holds its own connection to
+// the database, outside the pool.
+type HostListener struct {
+	dsn string
+	// Logger defaults to slog.Default.
+	Logger *slog.Logger
+}
+
+func NewHostListener(dsn string) *HostListener {
+	return &HostListener{dsn: dsn}
+}
+
+// Listen calls changed with every HostChange published until ctx is done.
+// Notifications sent while the connection was down are lost, so resync is
+// called whenever it has been re-established.
+func (l *HostListener) Listen(ctx context.Context, changed func(HostChange), resync func()) error {
+	logger := l.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	listener := pq.NewListener(l.dsn, listenerMinReconnect, listenerMaxReconnect, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.WarnContext(ctx, "host listener connection", "error", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(HostChangesChannel); err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// pq sends nil after reconnecting
+			if n == nil {
+				resync()
+				continue
+			}
+			change, err := parseHostChange(n.Extra)
+			if err != nil {
+				logger.WarnContext(ctx, "malformed host change", "payload", n.Extra, "error", err)
+				continue
+			}
+			changed(change)
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
+
+// parseHostChange decodes a HostChange. Replicas that predate request IDs
+// publish the bare host ID.
+func parseHostChange(payload string) (HostChange, error) {
+	if !strings.HasPrefix(payload, "{") {
+		return HostChange{HostID: payload}, nil
+	}
+
+	var change HostChange
+	if err := json.Unmarshal([]byte(payload), &change); err != nil {
+		return HostChange{}, err
+	}
+	return change, nil
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+// MemoryHostStore is an in-memory HostStore for tests and local runs. It is
+// safe for concurrent use and hands out copies, so callers can never mutate
+// the stored hosts directly.
+type MemoryHostStore struct {
+	mu     sync.RWMutex
+	hosts  map[string]*api.Host
+	events []*api.HostEvent
+}
+
+func NewMemoryHostStore() *MemoryHostStore {
+	return &MemoryHostStore{
+		hosts: make(map[string]*api.Host),
+	}
+}
+
+func (store *MemoryHostStore) Create(ctx context.Context, host *api.Host) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.hosts[host.ID]; ok {
+		return fmt.Errorf("host %q already exists: %w", host.ID, api.ErrConflict)
+	}
+
+	host.Version = 1
+	h := *host
+	store.hosts[host.ID] = &h
+	return nil
+}
+
+func (store *MemoryHostStore) GetByID(ctx context.Context, id string) (*api.Host, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	h, ok := store.hosts[id]
+	if !ok {
+		return nil, notFound(id)
+	}
+
+	host := *h
+	return &host, nil
+}
+
+func (store *MemoryHostStore) List(ctx context.Context, q HostQuery) (*HostPage, error) {
+	after := func(*api.Host) bool { return true }
+	if q.Cursor != "" {
+		createdAt, id, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = func(h *api.Host) bool {
+			if c := h.CreatedAt.Compare(createdAt); c != 0 {
+				return c > 0
+			}
+			return h.ID > id
+		}
+	}
+
+	store.mu.RLock()
+	var hosts []*api.Host
+	for _, h := range store.hosts {
+		if q.Matches(h) && after(h) {
+			host := *h
+			hosts = append(hosts, &host)
+		}
+	}
+	store.mu.RUnlock()
+
+	slices.SortFunc(hosts, func(a, b *api.Host) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	page := &HostPage{Hosts: hosts}
+	if limit := q.pageSize(); len(hosts) > limit {
+		page.Hosts = hosts[:limit]
+		page.NextCursor = encodeCursor(page.Hosts[limit-1])
+	}
+
+	return page, nil
+}
+
+func (store *MemoryHostStore) UpdateState(
+	ctx context.Context,
+	id string,
+	newState api.HostState,
+	expectedVersion int64,
+	change api.ChangeInfo,
+) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	h, ok := store.hosts[id]
+	if !ok {
+		return notFound(id)
+	}
+	if h.Version != expectedVersion {
+		return conflict(id)
+	}
+
+	store.record(id, api.HostEventState, string(h.State), string(newState), change)
+	h.State = newState
+	h.Version++
+	return nil
+}
+
+func (store *MemoryHostStore) UpdateHealth(
+	ctx context.Context,
+	id string,
+	newHealth api.HostHealth,
+	change api.ChangeInfo,
+) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	h, ok := store.hosts[id]
+	if !ok {
+		return notFound(id)
+	}
+	if h.Health == newHealth {
+		return nil
+	}
+
+	store.record(id, api.HostEventHealth, string(h.Health), string(newHealth), change)
+	h.Health = newHealth
+	h.Version++
+	return nil
+}
+
+func (store *MemoryHostStore) History(ctx context.Context, id string) ([]*api.HostEvent, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var events []*api.HostEvent
+	for _, e := range store.events {
+		if e.HostID == id {
+			event := *e
+			events = append(events, &event)
+		}
+	}
+
+	return events, nil
+}
+
+// record appends to the history. The caller must hold store.mu.
+func (store *MemoryHostStore) record(id string, field api.HostEventField, oldValue, newValue string, change api.ChangeInfo) {
+	store.events = append(store.events, &api.HostEvent{
+		ID:        int64(len(store.events) + 1),
+		HostID:    id,
+		Field:     field,
+		OldValue:  oldValue,
+		NewValue:  newValue,
+		Actor:     change.Actor,
+		Reason:    change.Reason,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+func (store *MemoryHostStore) Delete(ctx context.Context, id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.hosts[id]; !ok {
+		return notFound(id)
+	}
+
+	delete(store.hosts, id)
+	return nil
+}
@@ -0,0 +1,202 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+func seedMemoryStore(t *testing.T, hosts ...*api.Host) *store.MemoryHostStore {
+	t.Helper()
+
+	s := store.NewMemoryHostStore()
+	for _, h := range hosts {
+		if err := s.Create(context.Background(), h); err != nil {
+			t.Fatalf("Create(%s) failed: %v", h.ID, err)
+		}
+	}
+	return s
+}
+
+func TestMemoryHostStore_NotFound(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryHostStore()
+
+	if _, err := s.GetByID(ctx, "missing"); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("GetByID() error = %v, want api.ErrNotFound", err)
+	}
+	if err := s.UpdateState(ctx, "missing", api.HostReady, 1, api.ChangeInfo{}); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("UpdateState() error = %v, want api.ErrNotFound", err)
+	}
+	if err := s.UpdateHealth(ctx, "missing", api.HostHealthHealthy, api.ChangeInfo{}); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("UpdateHealth() error = %v, want api.ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "missing"); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("Delete() error = %v, want api.ErrNotFound", err)
+	}
+}
+
+func TestMemoryHostStore_Updates(t *testing.T) {
+	ctx := context.Background()
+	s := seedMemoryStore(t, &api.Host{ID: "host-1", State: api.HostProvisioning, Health: api.HostHealthUnknown})
+
+	if err := s.Create(ctx, &api.Host{ID: "host-1"}); err == nil {
+		t.Errorf("Create() with a duplicate id succeeded")
+	}
+
+	if err := s.UpdateState(ctx, "host-1", api.HostReady, 1, api.ChangeInfo{}); err != nil {
+		t.Fatalf("UpdateState() failed: %v", err)
+	}
+	if err := s.UpdateState(ctx, "host-1", api.HostDraining, 1, api.ChangeInfo{}); !errors.Is(err, api.ErrConflict) {
+		t.Fatalf("UpdateState() with a stale version error = %v, want api.ErrConflict", err)
+	}
+	if err := s.UpdateHealth(ctx, "host-1", api.HostHealthHealthy, api.ChangeInfo{}); err != nil {
+		t.Fatalf("UpdateHealth() failed: %v", err)
+	}
+
+	got, err := s.GetByID(ctx, "host-1")
+	if err != nil {
+		t.Fatalf("GetByID() failed: %v", err)
+	}
+	if got.State != api.HostReady || got.Health != api.HostHealthHealthy {
+		t.Errorf("GetByID() = %+v, want READY/healthy", got)
+	}
+	if got.Version != 3 {
+		t.Errorf("Version = %d, want 3 after two updates", got.Version)
+	}
+
+	// repeating the current health changes nothing
+	if err := s.UpdateHealth(ctx, "host-1", api.HostHealthHealthy, api.ChangeInfo{}); err != nil {
+		t.Fatalf("UpdateHealth() failed: %v", err)
+	}
+	events, err := s.History(ctx, "host-1")
+	if err != nil {
+		t.Fatalf("History() failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("History() returned %d events, want 2", len(events))
+	}
+
+	// mutating a returned host must not leak back into the store
+	got.State = api.HostTerminated
+	again, _ := s.GetByID(ctx, "host-1")
+	if again.State != api.HostReady {
+		t.Errorf("stored host was mutated through a returned copy")
+	}
+
+	if err := s.Delete(ctx, "host-1"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if _, err := s.GetByID(ctx, "host-1"); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("GetByID() after Delete() error = %v, want api.ErrNotFound", err)
+	}
+}
+
+func TestMemoryHostStore_List(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := seedMemoryStore(t,
+		&api.Host{ID: "host-c", Zone: "a", State: api.HostReady, CreatedAt: base.Add(2 * time.Minute)},
+		&api.Host{ID: "host-b", Zone: "b", State: api.HostDraining, CreatedAt: base.Add(time.Minute)},
+		&api.Host{ID: "host-a", Zone: "a", State: api.HostReady, CreatedAt: base.Add(time.Minute)},
+		&api.Host{ID: "host-d", Zone: "a", State: api.HostTerminated, CreatedAt: base},
+	)
+
+	tests := []struct {
+		name  string
+		query store.HostQuery
+		want  []string
+	}{
+		{
+			name: "everything ordered by creation time then id",
+			want: []string{"host-d", "host-a", "host-b", "host-c"},
+		},
+		{
+			name:  "filters are ANDed",
+			query: store.HostQuery{Zones: []string{"a"}, States: []api.HostState{api.HostReady}},
+			want:  []string{"host-a", "host-c"},
+		},
+		{
+			name:  "created after",
+			query: store.HostQuery{CreatedAfter: base.Add(time.Minute)},
+			want:  []string{"host-c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.List(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("List() failed: %v", err)
+			}
+			if got := hostIDs(page.Hosts); !slices.Equal(got, tt.want) {
+				t.Errorf("List() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("pages through every host exactly once", func(t *testing.T) {
+		var got []string
+		q := store.HostQuery{Limit: 3}
+		for {
+			page, err := s.List(ctx, q)
+			if err != nil {
+				t.Fatalf("List() failed: %v", err)
+			}
+			got = append(got, hostIDs(page.Hosts)...)
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+
+		want := []string{"host-d", "host-a", "host-b", "host-c"}
+		if !slices.Equal(got, want) {
+			t.Errorf("paged List() = %v, want %v", got, want)
+		}
+	})
+}
+
+func hostIDs(hosts []*api.Host) []string {
+	ids := make([]string, len(hosts))
+	for i, h := range hosts {
+		ids[i] = h.ID
+	}
+	return ids
+}
+
+func TestListAll(t *testing.T) {
+	var hosts []*api.Host
+	created := time.Now()
+	for i := range store.MaxPageSize + 2 {
+		state := api.HostReady
+		if i%2 == 1 {
+			state = api.HostDraining
+		}
+		hosts = append(hosts, &api.Host{ID: fmt.Sprintf("host-%04d", i), State: state, CreatedAt: created.Add(time.Duration(i))})
+	}
+	s := seedMemoryStore(t, hosts...)
+
+	all, err := store.ListAll(context.Background(), s, store.HostQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("ListAll() failed: %v", err)
+	}
+	if len(all) != len(hosts) {
+		t.Errorf("ListAll() returned %d hosts, want %d across pages", len(all), len(hosts))
+	}
+
+	ready, err := store.ListAll(context.Background(), s, store.HostQuery{States: []api.HostState{api.HostReady}})
+	if err != nil {
+		t.Fatalf("ListAll() failed: %v", err)
+	}
+	if len(ready) != len(hosts)/2 {
+		t.Errorf("ListAll(READY) returned %d hosts, want %d", len(ready), len(hosts)/2)
+	}
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+var ErrInvalidCursor = fmt.Errorf("invalid cursor: %w", api.ErrValidation)
+
+// HostQuery selects hosts from the catalog. Empty fields match everything;
+// multiple values for the same field are ORed together and different fields
+// are ANDed. Results are ordered by (CreatedAt, ID) so that Cursor can resume
+// a listing without skipping or repeating hosts.
+type HostQuery struct {
+	States        []api.HostState
+	Health        []api.HostHealth
+	Roles         []string
+	Zones         []string
+	Fleets        []string
+	ImageIDs      []string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	// Cursor is the NextCursor of a previous page.
+	Cursor string
+	// Limit is the page size. It defaults to DefaultPageSize and is capped
+	// at MaxPageSize.
+	Limit int
+}
+
+type HostPage struct {
+	Hosts []*api.Host
+	// NextCursor is empty when there are no more hosts.
+	NextCursor string
+}
+
+func (q HostQuery) pageSize() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultPageSize
+	case q.Limit > MaxPageSize:
+		return MaxPageSize
+	default:
+		return q.Limit
+	}
+}
+
+// where renders the query as a SQL WHERE clause (including the keyword) with
+// positional arguments, or an empty string if nothing is filtered.
+func (q HostQuery) where() (string, []any, error) {
+	var conds []string
+	var args []any
+
+	in := func(column string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		placeholders := make([]string, len(values))
+		for i, v := range values {
+			args = append(args, v)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conds = append(conds, column+" IN ("+strings.Join(placeholders, ", ")+")")
+	}
+
+	in("state", toStrings(q.States))
+	in("health", toStrings(q.Health))
+	in("role", q.Roles)
+	in("zone", q.Zones)
+	in("fleet", q.Fleets)
+	in("imageid", q.ImageIDs)
+
+	if !q.CreatedAfter.IsZero() {
+		args = append(args, q.CreatedAfter)
+		conds = append(conds, fmt.Sprintf("createdat > $%d", len(args)))
+	}
+	if !q.CreatedBefore.IsZero() {
+		args = append(args, q.CreatedBefore)
+		conds = append(conds, fmt.Sprintf("createdat < $%d", len(args)))
+	}
+
+	if q.Cursor != "" {
+		createdAt, id, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, createdAt, id)
+		conds = append(conds, fmt.Sprintf("(createdat, id) > ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	if len(conds) == 0 {
+		return "", args, nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+// Matches reports whether host satisfies the filters of q. Cursor and Limit
+// are ignored.
+func (q HostQuery) Matches(host *api.Host) bool {
+	switch {
+	case len(q.States) > 0 && !slices.Contains(q.States, host.State):
+		return false
+	case len(q.Health) > 0 && !slices.Contains(q.Health, host.Health):
+		return false
+	case len(q.Roles) > 0 && !slices.Contains(q.Roles, host.Role.Name):
+		return false
+	case len(q.Zones) > 0 && !slices.Contains(q.Zones, host.Zone):
+		return false
+	case len(q.Fleets) > 0 && !slices.Contains(q.Fleets, host.Fleet.Name):
+		return false
+	case len(q.ImageIDs) > 0 && !slices.Contains(q.ImageIDs, host.ImageID):
+		return false
+	case !q.CreatedAfter.IsZero() && !host.CreatedAt.After(q.CreatedAfter):
+		return false
+	case !q.CreatedBefore.IsZero() && !host.CreatedAt.Before(q.CreatedBefore):
+		return false
+	}
+	return true
+}
+
+func encodeCursor(host *api.Host) string {
+	raw := host.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + host.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	return createdAt, id, nil
+}
+
+func toStrings[T ~string](values []T) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = string(v)
+	}
+	return out
+}
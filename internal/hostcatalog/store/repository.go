@@ -3,13 +3,25 @@ package store
 import (
 	"context"
 	"database/sql"
-	"log"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 
+	"github.com/nabutabu/crane-oss/internal/logging"
+	"github.com/nabutabu/crane-oss/internal/tracing"
 	"github.com/nabutabu/crane-oss/pkg/api"
 )
 
+// HostChangesChannel is the Postgres notification channel on which a
+// HostChange is published whenever the state or health of a host changes.
+const HostChangesChannel = "host_changes"
+
+const hostColumns = "id, hostname, provider, providerid, role, zone, fleet, imageid, state, health, createdat, version"
+
 type PostgresHostStore struct {
 	DB *sql.DB
+	// Logger defaults to slog.Default.
+	Logger *slog.Logger
 }
 
 func NewPostgresHostStore(DB *sql.DB) *PostgresHostStore {
@@ -18,104 +30,324 @@ func NewPostgresHostStore(DB *sql.DB) *PostgresHostStore {
 	}
 }
 
-func (store *PostgresHostStore) Create(ctx context.Context, host *api.Host) error {
-	log.Println("/PostgresHostStore/Create")
-	query := "INSERT INTO host(id, role, zone, imageid, state, health, createdat) VALUES($1, $2, $3, $4, $5, $6, $7)"
-
-	_, err := store.DB.Exec(query, host.ID, host.Role.Name, host.Zone, host.ImageID, host.State, host.Health, host.CreatedAt)
-	if err != nil {
-		return err
+func (store *PostgresHostStore) logger() *slog.Logger {
+	if store.Logger == nil {
+		return slog.Default()
 	}
-
-	return nil
+	return store.Logger
 }
 
-func (store *PostgresHostStore) GetByID(ctx context.Context, id string) (*api.Host, error) {
-	query := `
-		SELECT id, role, zone, imageid, state, health, createdat
-		FROM host
-		WHERE id = $1
-	`
-
-	row := store.DB.QueryRowContext(ctx, query, id)
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
+func scanHost(row rowScanner) (*api.Host, error) {
 	var h api.Host
-	var role string
+	var role, fleet string
 
 	err := row.Scan(
 		&h.ID,
+		&h.HostName,
+		&h.Provider,
+		&h.ProviderID,
 		&role,
 		&h.Zone,
+		&fleet,
 		&h.ImageID,
 		&h.State,
 		&h.Health,
 		&h.CreatedAt,
+		&h.Version,
 	)
 	if err != nil {
 		return nil, err
 	}
 
 	h.Role = api.Role{Name: role}
+	h.Fleet = api.Fleet{Name: fleet}
 	return &h, nil
 }
 
-func (store *PostgresHostStore) UpdateState(ctx context.Context, id string, newState api.HostState) error {
-	log.Println("/PostgresHostStore/UpdateState")
+// Create inserts a new host. New hosts always start at version 1.
+func (store *PostgresHostStore) Create(ctx context.Context, host *api.Host) (err error) {
+	ctx, span := startSpan(ctx, "Create", "INSERT", "host", host.ID)
+	defer func() { tracing.End(span, err) }()
 
-	query := "UPDATE host SET state = $1 WHERE id = $2"
-	_, err := store.DB.Exec(query, newState, id)
+	store.logger().DebugContext(ctx, "create host", logging.KeyHostID, host.ID)
+	query := "INSERT INTO host(" + hostColumns + ") VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, 1)"
+
+	_, err = store.DB.ExecContext(
+		ctx,
+		query,
+		host.ID,
+		host.HostName,
+		host.Provider,
+		host.ProviderID,
+		host.Role.Name,
+		host.Zone,
+		host.Fleet.Name,
+		host.ImageID,
+		host.State,
+		host.Health,
+		host.CreatedAt,
+	)
 	if err != nil {
-		return err
+		return dbError(host.ID, err)
 	}
 
+	host.Version = 1
 	return nil
 }
 
-func (store *PostgresHostStore) UpdateHealth(ctx context.Context, id string, newHealth api.HostHealth) error {
-	log.Println("/PostgresHostStore/UpdateHealth")
+func (store *PostgresHostStore) GetByID(ctx context.Context, id string) (_ *api.Host, err error) {
+	ctx, span := startSpan(ctx, "GetByID", "SELECT", "host", id)
+	defer func() { tracing.End(span, err) }()
 
-	query := "UPDATE host SET health = $1 WHERE id = $2"
-	_, err := store.DB.Exec(query, newHealth, id)
+	query := `
+		SELECT ` + hostColumns + `
+		FROM host
+		WHERE id = $1
+	`
+
+	host, err := scanHost(store.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, dbError(id, err)
+	}
+
+	return host, nil
+}
+
+// UpdateState sets the state of a host if it is still at expectedVersion and
+// records the transition in the host history. It returns an error wrapping
+// api.ErrConflict if the host has been modified since that version.
+func (store *PostgresHostStore) UpdateState(
+	ctx context.Context,
+	id string,
+	newState api.HostState,
+	expectedVersion int64,
+	change api.ChangeInfo,
+) (err error) {
+	ctx, span := startSpan(ctx, "UpdateState", "UPDATE", "host", id)
+	defer func() { tracing.End(span, err) }()
+	store.logger().DebugContext(ctx, "update host state", logging.KeyHostID, id, "state", newState)
+
+	err = store.inTx(ctx, func(tx *sql.Tx) error {
+		var oldState api.HostState
+		var version int64
+		err := tx.QueryRowContext(ctx, "SELECT state, version FROM host WHERE id = $1 FOR UPDATE", id).
+			Scan(&oldState, &version)
+		if err != nil {
+			return err
+		}
+
+		if version != expectedVersion {
+			return conflict(id)
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE host SET state = $1, version = version + 1 WHERE id = $2", newState, id)
+		if err != nil {
+			return err
+		}
+
+		if err := insertEvent(ctx, tx, id, api.HostEventState, string(oldState), string(newState), change); err != nil {
+			return err
+		}
+
+		return notifyChange(ctx, tx, id)
+	})
+
+	return dbError(id, err)
+}
+
+// UpdateHealth sets the health of a host and records the change in the host
+// history. Reporting the health a host already has is a no-op.
+func (store *PostgresHostStore) UpdateHealth(
+	ctx context.Context,
+	id string,
+	newHealth api.HostHealth,
+	change api.ChangeInfo,
+) (err error) {
+	ctx, span := startSpan(ctx, "UpdateHealth", "UPDATE", "host", id)
+	defer func() { tracing.End(span, err) }()
+	store.logger().DebugContext(ctx, "update host health", logging.KeyHostID, id, "health", newHealth)
+
+	err = store.inTx(ctx, func(tx *sql.Tx) error {
+		var oldHealth api.HostHealth
+		err := tx.QueryRowContext(ctx, "SELECT health FROM host WHERE id = $1 FOR UPDATE", id).Scan(&oldHealth)
+		if err != nil {
+			return err
+		}
+
+		if oldHealth == newHealth {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE host SET health = $1, version = version + 1 WHERE id = $2", newHealth, id)
+		if err != nil {
+			return err
+		}
+
+		if err := insertEvent(ctx, tx, id, api.HostEventHealth, string(oldHealth), string(newHealth), change); err != nil {
+			return err
+		}
+
+		return notifyChange(ctx, tx, id)
+	})
+
+	return dbError(id, err)
+}
+
+// History returns every recorded change to a host, oldest first.
+func (store *PostgresHostStore) History(ctx context.Context, id string) (_ []*api.HostEvent, err error) {
+	ctx, span := startSpan(ctx, "History", "SELECT", "host_events", id)
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		SELECT id, hostid, field, oldvalue, newvalue, actor, reason, createdat
+		FROM host_events
+		WHERE hostid = $1
+		ORDER BY createdat, id
+	`
+
+	rows, err := store.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, dbError(id, err)
+	}
+	defer rows.Close()
+
+	var events []*api.HostEvent
+	for rows.Next() {
+		var e api.HostEvent
+		err := rows.Scan(&e.ID, &e.HostID, &e.Field, &e.OldValue, &e.NewValue, &e.Actor, &e.Reason, &e.CreatedAt)
+		if err != nil {
+			return nil, dbError(id, err)
+		}
+		events = append(events, &e)
+	}
+
+	return events, dbError(id, rows.Err())
+}
+
+func insertEvent(
+	ctx context.Context,
+	tx *sql.Tx,
+	id string,
+	field api.HostEventField,
+	oldValue string,
+	newValue string,
+	change api.ChangeInfo,
+) error {
+	query := "INSERT INTO host_events(hostid, field, oldvalue, newvalue, actor, reason) VALUES($1, $2, $3, $4, $5, $6)"
+	_, err := tx.ExecContext(ctx, query, id, field, oldValue, newValue, change.Actor, change.Reason)
+	return err
+}
+
+// HostChange is the payload published on HostChangesChannel.
+type HostChange struct {
+	HostID string `json:"host_id"`
+	// RequestID identifies the request that made the change, if any.
+	RequestID string `json:"request_id,omitempty"`
+	// TraceParent is the W3C traceparent of the span that made the change,
+	// if it was traced.
+	TraceParent string `json:"traceparent,omitempty"`
+}
+
+// notifyChange publishes a HostChange for id on HostChangesChannel. Postgres
+// delivers the notification when tx commits, and drops it if tx rolls back.
+func notifyChange(ctx context.Context, tx *sql.Tx, id string) error {
+	payload, err := json.Marshal(HostChange{
+		HostID:      id,
+		RequestID:   logging.RequestID(ctx),
+		TraceParent: tracing.TraceParent(ctx),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", HostChangesChannel, string(payload))
+	return err
+}
+
+func (store *PostgresHostStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := store.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a host from the catalog. It returns an error wrapping
+// api.ErrNotFound if no host with the given id exists.
+func (store *PostgresHostStore) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "Delete", "DELETE", "host", id)
+	defer func() { tracing.End(span, err) }()
+	store.logger().DebugContext(ctx, "delete host", logging.KeyHostID, id)
+
+	result, err := store.DB.ExecContext(ctx, "DELETE FROM host WHERE id = $1", id)
+	if err != nil {
+		return dbError(id, err)
+	}
+
+	return dbError(id, requireRow(result))
+}
+
+// requireRow turns a statement that touched no rows into sql.ErrNoRows.
+func requireRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
 	return nil
 }
 
-func (store *PostgresHostStore) ListHosts(ctx context.Context) ([]*api.Host, error) {
-	log.Println("/PostgresHostStore/UpdateHealth")
+// List returns one page of hosts matching q, ordered by creation time.
+func (store *PostgresHostStore) List(ctx context.Context, q HostQuery) (_ *HostPage, err error) {
+	ctx, span := startSpan(ctx, "List", "SELECT", "host", "")
+	defer func() { tracing.End(span, err) }()
+	store.logger().DebugContext(ctx, "list hosts")
 
-	query := `SELECT id, role, zone, imageid, state, health, createdat FROM host`
-	rows, err := store.DB.Query(query)
+	where, args, err := q.where()
 	if err != nil {
 		return nil, err
 	}
+
+	// fetch one extra row to find out whether there is a next page
+	limit := q.pageSize()
+	args = append(args, limit+1)
+	query := `SELECT ` + hostColumns + ` FROM host ` + where + fmt.Sprintf(` ORDER BY createdat, id LIMIT $%d`, len(args))
+
+	rows, err := store.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, dbError("", err)
+	}
 	defer rows.Close()
 
 	var hosts []*api.Host
 	for rows.Next() {
-		var host api.Host
-		var role string
-
-		err = rows.Scan(
-			&host.ID,
-			&role,
-			&host.Zone,
-			&host.ImageID,
-			&host.State,
-			&host.Health,
-			&host.CreatedAt,
-		)
+		host, err := scanHost(rows)
 		if err != nil {
-			return nil, err
+			return nil, dbError("", err)
 		}
+		hosts = append(hosts, host)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError("", err)
+	}
 
-		host.Role = api.Role{
-			Name: role,
-		}
-		hosts = append(hosts, &host)
+	page := &HostPage{Hosts: hosts}
+	if len(hosts) > limit {
+		page.Hosts = hosts[:limit]
+		page.NextCursor = encodeCursor(page.Hosts[limit-1])
 	}
 
-	return hosts, nil
+	return page, nil
 }
@@ -4,16 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"net"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 
 	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/internal/logging"
+	"github.com/nabutabu/crane-oss/internal/tracing"
 	"github.com/nabutabu/crane-oss/pkg/api"
 )
 
+var errQueryFailed = errors.New("query failed")
+
+const notifyQuery = `SELECT pg_notify\(\$1, \$2\)`
+
 func TestPostgresHostStore_Create(t *testing.T) {
 	now := time.Now()
 
@@ -26,22 +34,30 @@ func TestPostgresHostStore_Create(t *testing.T) {
 		{
 			name: "successfully inserts host",
 			host: &api.Host{
-				ID:        "host-1",
-				Role:      api.Role{Name: "worker"},
-				Zone:      "us-west-2a",
-				ImageID:   "ami-123",
-				State:     "running",
-				Health:    "healthy",
-				CreatedAt: now,
+				ID:         "host-1",
+				HostName:   "worker-1.us-west-2a",
+				Provider:   "aws",
+				ProviderID: "i-0abc",
+				Role:       api.Role{Name: "worker"},
+				Zone:       "us-west-2a",
+				Fleet:      api.Fleet{Name: "batch"},
+				ImageID:    "ami-123",
+				State:      "running",
+				Health:     "healthy",
+				CreatedAt:  now,
 			},
 			mock: func(mock sqlmock.Sqlmock) {
 				mock.ExpectExec(
-					`INSERT INTO host\(id, role, zone, imageid, state, health, createdat\) VALUES\(\$1, \$2, \$3, \$4, \$5, \$6, \$7\)`,
+					`INSERT INTO host\(id, hostname, provider, providerid, role, zone, fleet, imageid, state, health, createdat, version\) VALUES\(\$1, \$2, \$3, \$4, \$5, \$6, \$7, \$8, \$9, \$10, \$11, 1\)`,
 				).
 					WithArgs(
 						"host-1",
+						"worker-1.us-west-2a",
+						"aws",
+						"i-0abc",
 						"worker",
 						"us-west-2a",
+						"batch",
 						"ami-123",
 						"running",
 						"healthy",
@@ -64,7 +80,7 @@ func TestPostgresHostStore_Create(t *testing.T) {
 			},
 			mock: func(mock sqlmock.Sqlmock) {
 				mock.ExpectExec(
-					`INSERT INTO host\(id, role, zone, imageid, state, health, createdat\) VALUES\(\$1, \$2, \$3, \$4, \$5, \$6, \$7\)`,
+					`INSERT INTO host\(id, hostname, provider, providerid, role, zone, fleet, imageid, state, health, createdat, version\) VALUES\(\$1, \$2, \$3, \$4, \$5, \$6, \$7, \$8, \$9, \$10, \$11, 1\)`,
 				).
 					WillReturnError(errors.New("insert failed"))
 			},
@@ -117,31 +133,41 @@ func TestPostgresHostStore_GetByID(t *testing.T) {
 			id:   "host-1",
 			mock: func(mock sqlmock.Sqlmock) {
 				rows := sqlmock.NewRows(
-					[]string{"id", "role", "zone", "imageid", "state", "health", "createdat"},
+					[]string{"id", "hostname", "provider", "providerid", "role", "zone", "fleet", "imageid", "state", "health", "createdat", "version"},
 				).AddRow(
 					"host-1",
+					"worker-1.us-west-2a",
+					"aws",
+					"i-0abc",
 					"worker",
 					"us-west-2a",
+					"batch",
 					"ami-123",
 					"running",
 					"healthy",
 					now,
+					3,
 				)
 
 				mock.ExpectQuery(
-					`SELECT id, role, zone, imageid, state, health, createdat FROM host WHERE id = \$1`,
+					`SELECT id, hostname, provider, providerid, role, zone, fleet, imageid, state, health, createdat, version FROM host WHERE id = \$1`,
 				).
 					WithArgs("host-1").
 					WillReturnRows(rows)
 			},
 			want: &api.Host{
-				ID:        "host-1",
-				Role:      api.Role{Name: "worker"},
-				Zone:      "us-west-2a",
-				ImageID:   "ami-123",
-				State:     "running",
-				Health:    "healthy",
-				CreatedAt: now,
+				ID:         "host-1",
+				HostName:   "worker-1.us-west-2a",
+				Provider:   "aws",
+				ProviderID: "i-0abc",
+				Role:       api.Role{Name: "worker"},
+				Zone:       "us-west-2a",
+				Fleet:      api.Fleet{Name: "batch"},
+				ImageID:    "ami-123",
+				State:      "running",
+				Health:     "healthy",
+				CreatedAt:  now,
+				Version:    3,
 			},
 			wantErr: false,
 		},
@@ -150,7 +176,7 @@ func TestPostgresHostStore_GetByID(t *testing.T) {
 			id:   "missing-host",
 			mock: func(mock sqlmock.Sqlmock) {
 				mock.ExpectQuery(
-					`SELECT id, role, zone, imageid, state, health, createdat FROM host WHERE id = \$1`,
+					`SELECT id, hostname, provider, providerid, role, zone, fleet, imageid, state, health, createdat, version FROM host WHERE id = \$1`,
 				).
 					WithArgs("missing-host").
 					WillReturnError(sql.ErrNoRows)
@@ -199,44 +225,108 @@ func TestPostgresHostStore_GetByID(t *testing.T) {
 }
 
 func TestPostgresHostStore_UpdateState(t *testing.T) {
+	const selectQuery = `SELECT state, version FROM host WHERE id = \$1 FOR UPDATE`
+	const updateQuery = `UPDATE host SET state = \$1, version = version \+ 1 WHERE id = \$2`
+	const eventQuery = `INSERT INTO host_events\(hostid, field, oldvalue, newvalue, actor, reason\) VALUES\(\$1, \$2, \$3, \$4, \$5, \$6\)`
+
+	change := api.ChangeInfo{Actor: "alice", Reason: "kernel upgrade"}
+
 	tests := []struct {
 		name    string
 		id      string
 		state   api.HostState
+		version int64
 		mock    func(sqlmock.Sqlmock)
-		wantErr bool
+		wantErr error
 	}{
 		{
-			name:  "successfully updates host state",
-			id:    "host-1",
-			state: api.HostDraining,
+			name:    "updates state and records the transition",
+			id:      "host-1",
+			state:   api.HostDraining,
+			version: 2,
 			mock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec(
-					`UPDATE host SET state = \$1 WHERE id = \$2`,
-				).
-					WithArgs(
-						api.HostDraining,
-						"host-1",
-					).
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).
+					WithArgs("host-1").
+					WillReturnRows(sqlmock.NewRows([]string{"state", "version"}).AddRow("READY", 2))
+				mock.ExpectExec(updateQuery).
+					WithArgs(api.HostDraining, "host-1").
 					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(eventQuery).
+					WithArgs("host-1", api.HostEventState, "READY", "DRAINING", "alice", "kernel upgrade").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(notifyQuery).
+					WithArgs(store.HostChangesChannel, `{"host_id":"host-1"}`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
 			},
-			wantErr: false,
 		},
 		{
-			name:  "database error is returned",
-			id:    "host-2",
-			state: api.HostTerminated,
+			name:    "database error rolls back",
+			id:      "host-2",
+			state:   api.HostTerminated,
+			version: 1,
 			mock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec(
-					`UPDATE host SET state = \$1 WHERE id = \$2`,
-				).
-					WithArgs(
-						api.HostTerminated,
-						"host-2",
-					).
-					WillReturnError(errors.New("update failed"))
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).
+					WithArgs("host-2").
+					WillReturnRows(sqlmock.NewRows([]string{"state", "version"}).AddRow("DRAINING", 1))
+				mock.ExpectExec(updateQuery).
+					WithArgs(api.HostTerminated, "host-2").
+					WillReturnError(errQueryFailed)
+				mock.ExpectRollback()
 			},
-			wantErr: true,
+			wantErr: errQueryFailed,
+		},
+		{
+			name:    "failed notification rolls back",
+			id:      "host-1",
+			state:   api.HostDraining,
+			version: 2,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).
+					WithArgs("host-1").
+					WillReturnRows(sqlmock.NewRows([]string{"state", "version"}).AddRow("READY", 2))
+				mock.ExpectExec(updateQuery).
+					WithArgs(api.HostDraining, "host-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(eventQuery).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(notifyQuery).
+					WithArgs(store.HostChangesChannel, `{"host_id":"host-1"}`).
+					WillReturnError(errQueryFailed)
+				mock.ExpectRollback()
+			},
+			wantErr: errQueryFailed,
+		},
+		{
+			name:    "stale version is a conflict",
+			id:      "host-1",
+			state:   api.HostDraining,
+			version: 1,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).
+					WithArgs("host-1").
+					WillReturnRows(sqlmock.NewRows([]string{"state", "version"}).AddRow("READY", 2))
+				mock.ExpectRollback()
+			},
+			wantErr: api.ErrConflict,
+		},
+		{
+			name:    "host not found",
+			id:      "missing-host",
+			state:   api.HostReady,
+			version: 1,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).
+					WithArgs("missing-host").
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			wantErr: api.ErrNotFound,
 		},
 	}
 
@@ -254,17 +344,9 @@ func TestPostgresHostStore_UpdateState(t *testing.T) {
 
 			tt.mock(mock)
 
-			err = store.UpdateState(context.Background(), tt.id, tt.state)
-
-			if tt.wantErr {
-				if err == nil {
-					t.Fatalf("expected error, got nil")
-				}
-				return
-			}
-
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
+			err = store.UpdateState(context.Background(), tt.id, tt.state, tt.version, change)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateState() error = %v, want %v", err, tt.wantErr)
 			}
 
 			if err := mock.ExpectationsWereMet(); err != nil {
@@ -275,44 +357,74 @@ func TestPostgresHostStore_UpdateState(t *testing.T) {
 }
 
 func TestPostgresHostStore_UpdateHealth(t *testing.T) {
+	const selectQuery = `SELECT health FROM host WHERE id = \$1 FOR UPDATE`
+	const updateQuery = `UPDATE host SET health = \$1, version = version \+ 1 WHERE id = \$2`
+
 	tests := []struct {
 		name    string
 		id      string
 		health  string
 		mock    func(sqlmock.Sqlmock)
-		wantErr bool
+		wantErr error
 	}{
 		{
-			name:   "successfully updates host health",
+			name:   "updates health and records the change",
 			id:     "host-1",
-			health: "healthy",
+			health: "unhealthy",
 			mock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec(
-					`UPDATE host SET health = \$1 WHERE id = \$2`,
-				).
-					WithArgs(
-						"healthy",
-						"host-1",
-					).
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).
+					WithArgs("host-1").
+					WillReturnRows(sqlmock.NewRows([]string{"health"}).AddRow("healthy"))
+				mock.ExpectExec(updateQuery).
+					WithArgs("unhealthy", "host-1").
 					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO host_events`).
+					WithArgs("host-1", api.HostEventHealth, "healthy", "unhealthy", "agent", "").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(notifyQuery).
+					WithArgs(store.HostChangesChannel, `{"host_id":"host-1","request_id":"req-1","traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:   "unchanged health is a no-op",
+			id:     "host-1",
+			health: "healthy",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).
+					WithArgs("host-1").
+					WillReturnRows(sqlmock.NewRows([]string{"health"}).AddRow("healthy"))
+				mock.ExpectCommit()
 			},
-			wantErr: false,
 		},
 		{
 			name:   "database error is returned",
 			id:     "host-2",
 			health: "unhealthy",
 			mock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec(
-					`UPDATE host SET health = \$1 WHERE id = \$2`,
-				).
-					WithArgs(
-						"unhealthy",
-						"host-2",
-					).
-					WillReturnError(errors.New("update failed"))
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).
+					WithArgs("host-2").
+					WillReturnError(errQueryFailed)
+				mock.ExpectRollback()
 			},
-			wantErr: true,
+			wantErr: errQueryFailed,
+		},
+		{
+			name:   "host not found",
+			id:     "missing-host",
+			health: "healthy",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).
+					WithArgs("missing-host").
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			wantErr: api.ErrNotFound,
 		},
 	}
 
@@ -330,17 +442,93 @@ func TestPostgresHostStore_UpdateHealth(t *testing.T) {
 
 			tt.mock(mock)
 
-			err = store.UpdateHealth(context.Background(), tt.id, api.HostHealth(tt.health))
+			ctx := logging.WithRequestID(context.Background(), "req-1")
+			ctx = tracing.WithTraceParent(ctx, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			err = store.UpdateHealth(ctx, tt.id, api.HostHealth(tt.health), api.ChangeInfo{Actor: "agent"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateHealth() error = %v, want %v", err, tt.wantErr)
+			}
 
-			if tt.wantErr {
-				if err == nil {
-					t.Fatalf("expected error, got nil")
-				}
-				return
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet sql expectations: %v", err)
 			}
+		})
+	}
+}
+
+func TestPostgresHostStore_History(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT id, hostid, field, oldvalue, newvalue, actor, reason, createdat FROM host_events WHERE hostid = \$1 ORDER BY createdat, id`).
+		WithArgs("host-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "hostid", "field", "oldvalue", "newvalue", "actor", "reason", "createdat"}).
+			AddRow(1, "host-1", "state", "PROVISIONING", "READY", "agent", "", now).
+			AddRow(2, "host-1", "state", "READY", "DRAINING", "alice", "kernel upgrade", now))
+
+	got, err := store.NewPostgresHostStore(db).History(context.Background(), "host-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []*api.HostEvent{
+		{ID: 1, HostID: "host-1", Field: api.HostEventState, OldValue: "PROVISIONING", NewValue: "READY", Actor: "agent", CreatedAt: now},
+		{ID: 2, HostID: "host-1", Field: api.HostEventState, OldValue: "READY", NewValue: "DRAINING", Actor: "alice", Reason: "kernel upgrade", CreatedAt: now},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("History() = %+v, want %+v", got, want)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet sql expectations: %v", err)
+	}
+}
+
+func TestPostgresHostStore_Delete(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		mock    func(sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "successfully deletes host",
+			id:   "host-1",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM host WHERE id = \$1`).
+					WithArgs("host-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "host not found",
+			id:   "missing-host",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM host WHERE id = \$1`).
+					WithArgs("missing-host").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: api.ErrNotFound,
+		},
+	}
 
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
 			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
+				t.Fatalf("failed to create sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			tt.mock(mock)
+
+			err = store.NewPostgresHostStore(db).Delete(context.Background(), tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Delete() error = %v, want %v", err, tt.wantErr)
 			}
 
 			if err := mock.ExpectationsWereMet(); err != nil {
@@ -350,77 +538,112 @@ func TestPostgresHostStore_UpdateHealth(t *testing.T) {
 	}
 }
 
-func TestPostgresHostStore_ListHosts(t *testing.T) {
-	now := time.Now()
+func TestPostgresHostStore_List(t *testing.T) {
+	now := time.Now().UTC()
+	columns := []string{"id", "hostname", "provider", "providerid", "role", "zone", "fleet", "imageid", "state", "health", "createdat", "version"}
+
+	host1 := &api.Host{
+		ID:         "host-1",
+		HostName:   "worker-1",
+		Provider:   "aws",
+		ProviderID: "i-0abc",
+		Role:       api.Role{Name: "worker"},
+		Zone:       "us-west-2a",
+		Fleet:      api.Fleet{Name: "batch"},
+		ImageID:    "ami-123",
+		State:      "running",
+		Health:     "healthy",
+		CreatedAt:  now,
+		Version:    1,
+	}
+	host2 := &api.Host{
+		ID:         "host-2",
+		HostName:   "cp-1",
+		Provider:   "aws",
+		ProviderID: "i-0def",
+		Role:       api.Role{Name: "control-plane"},
+		Zone:       "us-east-1a",
+		Fleet:      api.Fleet{Name: "core"},
+		ImageID:    "ami-456",
+		State:      "pending",
+		Health:     "unknown",
+		CreatedAt:  now,
+		Version:    4,
+	}
+	addRow := func(rows *sqlmock.Rows, h *api.Host) *sqlmock.Rows {
+		return rows.AddRow(h.ID, h.HostName, h.Provider, h.ProviderID, h.Role.Name, h.Zone, h.Fleet.Name, h.ImageID, h.State, h.Health, h.CreatedAt, h.Version)
+	}
 
 	tests := []struct {
-		name    string
-		mock    func(sqlmock.Sqlmock)
-		want    []*api.Host
-		wantErr bool
+		name       string
+		query      store.HostQuery
+		mock       func(sqlmock.Sqlmock)
+		want       []*api.Host
+		wantCursor bool
+		wantErr    error
 	}{
 		{
 			name: "returns multiple hosts",
 			mock: func(mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows(
-					[]string{"id", "role", "zone", "imageid", "state", "health", "createdat"},
+				rows := sqlmock.NewRows(columns)
+				addRow(rows, host1)
+				addRow(rows, host2)
+
+				mock.ExpectQuery(
+					`SELECT id, hostname, provider, providerid, role, zone, fleet, imageid, state, health, createdat, version FROM host ORDER BY createdat, id LIMIT \$1`,
 				).
-					AddRow(
-						"host-1",
-						"worker",
-						"us-west-2a",
-						"ami-123",
-						"running",
-						"healthy",
-						now,
-					).
-					AddRow(
-						"host-2",
-						"control-plane",
-						"us-east-1a",
-						"ami-456",
-						"pending",
-						"unknown",
-						now,
-					)
+					WithArgs(store.DefaultPageSize + 1).
+					WillReturnRows(rows)
+			},
+			want: []*api.Host{host1, host2},
+		},
+		{
+			name: "applies filters",
+			query: store.HostQuery{
+				States:       []api.HostState{api.HostReady, api.HostDraining},
+				Zones:        []string{"us-west-2a"},
+				CreatedAfter: now.Add(-time.Hour),
+			},
+			mock: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(columns)
+				addRow(rows, host1)
 
 				mock.ExpectQuery(
-					`SELECT id, role, zone, imageid, state, health, createdat FROM host`,
+					`FROM host WHERE state IN \(\$1, \$2\) AND zone IN \(\$3\) AND createdat > \$4 ORDER BY createdat, id LIMIT \$5`,
 				).
+					WithArgs(api.HostReady, api.HostDraining, "us-west-2a", now.Add(-time.Hour), store.DefaultPageSize+1).
 					WillReturnRows(rows)
 			},
-			want: []*api.Host{
-				{
-					ID:        "host-1",
-					Role:      api.Role{Name: "worker"},
-					Zone:      "us-west-2a",
-					ImageID:   "ami-123",
-					State:     "running",
-					Health:    "healthy",
-					CreatedAt: now,
-				},
-				{
-					ID:        "host-2",
-					Role:      api.Role{Name: "control-plane"},
-					Zone:      "us-east-1a",
-					ImageID:   "ami-456",
-					State:     "pending",
-					Health:    "unknown",
-					CreatedAt: now,
-				},
+			want: []*api.Host{host1},
+		},
+		{
+			name:  "returns a cursor when there are more hosts",
+			query: store.HostQuery{Limit: 1},
+			mock: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(columns)
+				addRow(rows, host1)
+				addRow(rows, host2)
+
+				mock.ExpectQuery(`ORDER BY createdat, id LIMIT \$1`).
+					WithArgs(2).
+					WillReturnRows(rows)
 			},
-			wantErr: false,
+			want:       []*api.Host{host1},
+			wantCursor: true,
+		},
+		{
+			name:    "rejects a malformed cursor",
+			query:   store.HostQuery{Cursor: "not a cursor"},
+			mock:    func(mock sqlmock.Sqlmock) {},
+			wantErr: store.ErrInvalidCursor,
 		},
 		{
 			name: "database error is returned",
 			mock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery(
-					`SELECT id, role, zone, imageid, state, health, createdat FROM host`,
-				).
-					WillReturnError(errors.New("query failed"))
+				mock.ExpectQuery(`FROM host`).
+					WillReturnError(errQueryFailed)
 			},
-			want:    nil,
-			wantErr: true,
+			wantErr: errQueryFailed,
 		},
 	}
 
@@ -436,11 +659,11 @@ func TestPostgresHostStore_ListHosts(t *testing.T) {
 
 			store := store.NewPostgresHostStore(db)
 
-			got, err := store.ListHosts(context.Background())
+			got, err := store.List(context.Background(), tt.query)
 
-			if tt.wantErr {
-				if err == nil {
-					t.Fatalf("expected error, got nil")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("List() error = %v, want %v", err, tt.wantErr)
 				}
 				return
 			}
@@ -449,8 +672,12 @@ func TestPostgresHostStore_ListHosts(t *testing.T) {
 				t.Fatalf("unexpected error: %v", err)
 			}
 
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("ListHosts() = %+v, want %+v", got, tt.want)
+			if !reflect.DeepEqual(got.Hosts, tt.want) {
+				t.Errorf("List() = %+v, want %+v", got.Hosts, tt.want)
+			}
+
+			if (got.NextCursor != "") != tt.wantCursor {
+				t.Errorf("List() NextCursor = %q, want cursor: %v", got.NextCursor, tt.wantCursor)
 			}
 
 			if err := mock.ExpectationsWereMet(); err != nil {
@@ -459,3 +686,85 @@ func TestPostgresHostStore_ListHosts(t *testing.T) {
 		})
 	}
 }
+
+func TestPostgresHostStore_List_Cursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	columns := []string{"id", "hostname", "provider", "providerid", "role", "zone", "fleet", "imageid", "state", "health", "createdat", "version"}
+	rows := sqlmock.NewRows(columns).
+		AddRow("host-1", "", "", "", "worker", "z", "", "ami", "READY", "healthy", now, 1).
+		AddRow("host-2", "", "", "", "worker", "z", "", "ami", "READY", "healthy", now, 1)
+	mock.ExpectQuery(`LIMIT \$1`).WithArgs(2).WillReturnRows(rows)
+
+	s := store.NewPostgresHostStore(db)
+	page, err := s.List(context.Background(), store.HostQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the second page resumes strictly after the last host of the first
+	mock.ExpectQuery(`WHERE \(createdat, id\) > \(\$1, \$2\) ORDER BY createdat, id LIMIT \$3`).
+		WithArgs(now, "host-1", 2).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	if _, err := s.List(context.Background(), store.HostQuery{Limit: 1, Cursor: page.NextCursor}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet sql expectations: %v", err)
+	}
+}
+
+func TestPostgresHostStore_ErrorTranslation(t *testing.T) {
+	tests := []struct {
+		name    string
+		dbErr   error
+		wantErr error
+	}{
+		{name: "no rows is not found", dbErr: sql.ErrNoRows, wantErr: api.ErrNotFound},
+		{name: "connection failure is unavailable", dbErr: &pq.Error{Code: "08006"}, wantErr: api.ErrUnavailable},
+		{name: "admin shutdown is unavailable", dbErr: &pq.Error{Code: "57P01"}, wantErr: api.ErrUnavailable},
+		{name: "network error is unavailable", dbErr: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, wantErr: api.ErrUnavailable},
+		{name: "other errors pass through", dbErr: errQueryFailed, wantErr: errQueryFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`FROM host WHERE id = \$1`).
+				WithArgs("host-1").
+				WillReturnError(tt.dbErr)
+
+			_, err = store.NewPostgresHostStore(db).GetByID(context.Background(), "host-1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetByID() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("duplicate id is a conflict", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectExec(`INSERT INTO host`).WillReturnError(&pq.Error{Code: "23505"})
+
+		err = store.NewPostgresHostStore(db).Create(context.Background(), &api.Host{ID: "host-1"})
+		if !errors.Is(err, api.ErrConflict) {
+			t.Errorf("Create() error = %v, want %v", err, api.ErrConflict)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+// HostStore persists the host catalog. Implementations return errors wrapping
+// api.ErrNotFound when the requested host does not exist and api.ErrConflict
+// when a write is made against a stale version. UpdateState and UpdateHealth
+// append to the host history atomically with the change itself.
+type HostStore interface {
+	Create(ctx context.Context, host *api.Host) error
+	GetByID(ctx context.Context, id string) (*api.Host, error)
+	List(ctx context.Context, q HostQuery) (*HostPage, error)
+	UpdateState(ctx context.Context, id string, newState api.HostState, expectedVersion int64, change api.ChangeInfo) error
+	UpdateHealth(ctx context.Context, id string, newHealth api.HostHealth, change api.ChangeInfo) error
+	History(ctx context.Context, id string) ([]*api.HostEvent, error)
+	Delete(ctx context.Context, id string) error
+}
+
+var (
+	_ HostStore = (*PostgresHostStore)(nil)
+	_ HostStore = (*MemoryHostStore)(nil)
+)
+
+// ListAll returns every host in hosts matching q, fetching as many pages as
+// it takes. q.Limit and q.Cursor are ignored.
+func ListAll(ctx context.Context, hosts HostStore, q HostQuery) ([]*api.Host, error) {
+	var all []*api.Host
+	q.Limit = MaxPageSize
+	q.Cursor = ""
+
+	for {
+		page, err := hosts.List(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page.Hosts...)
+
+		if page.NextCursor == "" {
+			return all, nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+func notFound(id string) error {
+	return fmt.Errorf("host %q: %w", id, api.ErrNotFound)
+}
+
+func conflict(id string) error {
+	return fmt.Errorf("host %q was modified concurrently: %w", id, api.ErrConflict)
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+// HostSummary counts the hosts sharing a state, health, role and zone.
+type HostSummary struct {
+	State  api.HostState
+	Health api.HostHealth
+	Role   string
+	Zone   string
+	Count  int
+}
+
+// Summary counts the hosts in the catalog by state, health, role and zone.
+func (store *PostgresHostStore) Summary(ctx context.Context) ([]HostSummary, error) {
+	rows, err := store.DB.QueryContext(ctx, `
+		SELECT state, health, role, zone, COUNT(*)
+		FROM host
+		GROUP BY state, health, role, zone
+		ORDER BY state, health, role, zone
+	`)
+	if err != nil {
+		return nil, dbError("", err)
+	}
+	defer rows.Close()
+
+	var summary []HostSummary
+	for rows.Next() {
+		var s HostSummary
+		if err := rows.Scan(&s.State, &s.Health, &s.Role, &s.Zone, &s.Count); err != nil {
+			return nil, dbError("", err)
+		}
+		summary = append(summary, s)
+	}
+
+	return summary, dbError("", rows.Err())
+}
+
+// OldestInState returns, for every state some host is in, when the host that
+// has been in it longest entered it. Hosts that never changed state entered
+// it when they were registered.
+func (store *PostgresHostStore) OldestInState(ctx context.Context) (map[api.HostState]time.Time, error) {
+	rows, err := store.DB.QueryContext(ctx, `
+		SELECT h.state, MIN(COALESCE(e.enteredat, h.createdat))
+		FROM host h
+		LEFT JOIN (
+			SELECT hostid, MAX(createdat) AS enteredat
+			FROM host_events
+			WHERE field = 'state'
+			GROUP BY hostid
+		) e ON e.hostid = h.id
+		GROUP BY h.state
+	`)
+	if err != nil {
+		return nil, dbError("", err)
+	}
+	defer rows.Close()
+
+	oldest := make(map[api.HostState]time.Time)
+	for rows.Next() {
+		var state api.HostState
+		var since time.Time
+		if err := rows.Scan(&state, &since); err != nil {
+			return nil, dbError("", err)
+		}
+		oldest[state] = since
+	}
+
+	return oldest, dbError("", rows.Err())
+}
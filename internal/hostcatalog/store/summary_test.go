@@ -0,0 +1,70 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+func TestPostgresHostStore_Summary(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT state, health, role, zone, COUNT\(\*\) FROM host GROUP BY state, health, role, zone`).
+		WillReturnRows(sqlmock.NewRows([]string{"state", "health", "role", "zone", "count"}).
+			AddRow("READY", "healthy", "worker", "a", 3).
+			AddRow("DRAINING", "unknown", "worker", "b", 1))
+
+	summary, err := store.NewPostgresHostStore(db).Summary(context.Background())
+	if err != nil {
+		t.Fatalf("Summary() failed: %v", err)
+	}
+
+	want := []store.HostSummary{
+		{State: api.HostReady, Health: api.HostHealthHealthy, Role: "worker", Zone: "a", Count: 3},
+		{State: api.HostDraining, Health: api.HostHealthUnknown, Role: "worker", Zone: "b", Count: 1},
+	}
+	if len(summary) != len(want) {
+		t.Fatalf("Summary() = %+v, want %+v", summary, want)
+	}
+	for i := range want {
+		if summary[i] != want[i] {
+			t.Errorf("Summary()[%d] = %+v, want %+v", i, summary[i], want[i])
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet sql expectations: %v", err)
+	}
+}
+
+func TestPostgresHostStore_OldestInState(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	since := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(`SELECT h.state, MIN\(COALESCE\(e.enteredat, h.createdat\)\) FROM host h LEFT JOIN`).
+		WillReturnRows(sqlmock.NewRows([]string{"state", "min"}).AddRow("DRAINING", since))
+
+	oldest, err := store.NewPostgresHostStore(db).OldestInState(context.Background())
+	if err != nil {
+		t.Fatalf("OldestInState() failed: %v", err)
+	}
+	if len(oldest) != 1 || !oldest[api.HostDraining].Equal(since) {
+		t.Errorf("OldestInState() = %v, want DRAINING since %s", oldest, since)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet sql expectations: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package store
+
+import (
+	"context"
+
+	"github.com/nabutabu/crane-oss/internal/tracing"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/nabutabu/crane-oss/internal/hostcatalog/store")
+
+// startSpan starts the span of a PostgresHostStore method, whose SQL is
+// mostly operation on table. hostID is left out if empty.
+func startSpan(ctx context.Context, method, operation, table, hostID string) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, "PostgresHostStore."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBCollectionName(table),
+		),
+	)
+	if hostID != "" {
+		span.SetAttributes(tracing.KeyHostID.String(hostID))
+	}
+	return ctx, span
+}
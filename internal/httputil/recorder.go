@@ -0,0 +1,27 @@
+// Package httputil holds HTTP helpers shared by crane's middleware.
+package httputil
+
+import "net/http"
+
+// StatusRecorder is a ResponseWriter that remembers the status code written
+// through it, for middleware that reports on the response.
+type StatusRecorder struct {
+	http.ResponseWriter
+	// Status is http.StatusOK until a handler writes another code.
+	Status int
+}
+
+// NewStatusRecorder wraps w.
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (rec *StatusRecorder) WriteHeader(status int) {
+	rec.Status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (rec *StatusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
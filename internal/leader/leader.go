@@ -0,0 +1,221 @@
+// Package leader elects a single replica to run work that must not run
+// concurrently, such as reconciling the fleet.
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LockName names the lock replicas campaign for.
+const LockName = "crane-reconciler"
+
+// releaseTimeout bounds how long stepping down waits to release the lock.
+const releaseTimeout = 5 * time.Second
+
+type Status struct {
+	ID      string `json:"id"`
+	Backend string `json:"backend"`
+	Leader  bool   `json:"leader"`
+	// Holder is the ID of the current leader, if the backend can tell.
+	Holder string    `json:"holder,omitempty"`
+	Since  time.Time `json:"since,omitzero"`
+}
+
+// Elector campaigns for a Lock and runs a function while it holds it.
+type Elector struct {
+	lock     Lock
+	id       string
+	backend  string
+	lease    time.Duration
+	interval time.Duration
+	// Logger defaults to slog.Default.
+	Logger *slog.Logger
+
+	mu     sync.Mutex
+	leader bool
+	since  time.Time
+}
+
+// NewElector returns an Elector for a lock that another replica may take
+// over once it has gone lease without being renewed. The Elector tries to
+// take or renew it three times per lease. backend names the kind of lock
+// for Status.
+func NewElector(lock Lock, id, backend string, lease time.Duration) *Elector {
+	return &Elector{
+		lock:     lock,
+		id:       id,
+		backend:  backend,
+		lease:    lease,
+		interval: lease / 3,
+	}
+}
+
+func (e *Elector) logger() *slog.Logger {
+	if e.Logger == nil {
+		return slog.Default()
+	}
+	return e.Logger
+}
+
+// Run campaigns for leadership until ctx is cancelled and runs fn whenever
+// this replica is the leader. The context passed to fn is cancelled as soon
+// as leadership is lost, and Run waits for fn to return before campaigning
+// again. Any error from the lock counts as losing leadership, since the lock
+// can no longer be vouched for, and so does an attempt that takes longer
+// than the interval. Should renewals still stall, fn is cancelled once the
+// lease has gone unrenewed, before another replica can take over.
+func (e *Elector) Run(ctx context.Context, fn func(ctx context.Context)) {
+	logger := e.logger()
+	var current *term
+	stepDown := func() {
+		if current == nil {
+			return
+		}
+		current.stop()
+		current = nil
+		e.setLeader(false)
+		logger.Info("leader: stepped down", "replica", e.id)
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		// the lease is only good from before the attempt
+		attempted := time.Now()
+		attemptCtx, cancel := context.WithTimeout(ctx, e.interval)
+		held, err := e.lock.TryAcquire(attemptCtx)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			logger.Warn("leader: acquire lock", "replica", e.id, "error", err)
+		}
+
+		if current != nil && current.expired() && ctx.Err() == nil {
+			logger.Warn("leader: lease ran out before it was renewed", "replica", e.id)
+			stepDown()
+		}
+
+		switch {
+		case held && current == nil:
+			logger.Info("leader: now the leader", "replica", e.id)
+			e.setLeader(true)
+			current = startTerm(ctx, e.lease-time.Since(attempted), fn)
+		case held:
+			current.renew(e.lease - time.Since(attempted))
+		case !held:
+			stepDown()
+		}
+
+		select {
+		case <-ctx.Done():
+			stepDown()
+
+			releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+			defer cancel()
+			if err := e.lock.Release(releaseCtx); err != nil {
+				logger.Warn("leader: release lock", "replica", e.id, "error", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// term is fn running for as long as this replica leads. fn is cancelled
+// when the lease it was started under runs out, unless it is renewed first.
+type term struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	expiry *time.Timer
+	done   chan struct{}
+}
+
+func startTerm(ctx context.Context, lease time.Duration, fn func(ctx context.Context)) *term {
+	ctx, cancel := context.WithCancel(ctx)
+	t := &term{
+		ctx:    ctx,
+		cancel: cancel,
+		expiry: time.AfterFunc(lease, cancel),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(t.done)
+		fn(ctx)
+	}()
+	return t
+}
+
+// renew moves the end of the lease to lease from now.
+func (t *term) renew(lease time.Duration) {
+	t.expiry.Reset(lease)
+}
+
+// expired reports whether fn was cancelled because the lease ran out.
+func (t *term) expired() bool {
+	return t.ctx.Err() != nil
+}
+
+// stop cancels fn and waits for it to return.
+func (t *term) stop() {
+	t.expiry.Stop()
+	t.cancel()
+	<-t.done
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.leader = leader
+	e.since = time.Time{}
+	if leader {
+		e.since = time.Now().UTC()
+	}
+}
+
+// IsLeader reports whether this replica currently leads.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+func (e *Elector) Status(ctx context.Context) (Status, error) {
+	e.mu.Lock()
+	status := Status{
+		ID:      e.id,
+		Backend: e.backend,
+		Leader:  e.leader,
+		Since:   e.since,
+	}
+	e.mu.Unlock()
+
+	if status.Leader {
+		status.Holder = e.id
+		return status, nil
+	}
+
+	holder, err := e.lock.Holder(ctx)
+	if err != nil {
+		return status, err
+	}
+	status.Holder = holder
+	return status, nil
+}
+
+// ServeHTTP reports the Status of this replica.
+func (e *Elector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status, err := e.Status(r.Context())
+	if err != nil {
+		// the local view is still worth reporting
+		e.logger().WarnContext(r.Context(), "leader: look up holder", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
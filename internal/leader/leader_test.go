@@ -0,0 +1,216 @@
+package leader_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/leader"
+)
+
+// fakeLock is held whenever held is true; err makes TryAcquire fail.
+type fakeLock struct {
+	mu       sync.Mutex
+	held     bool
+	err      error
+	released bool
+}
+
+func (l *fakeLock) set(held bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held, l.err = held, err
+}
+
+func (l *fakeLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.held && l.err == nil, l.err
+}
+
+func (l *fakeLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.released = true
+	return nil
+}
+
+func (l *fakeLock) Holder(ctx context.Context) (string, error) {
+	return "other", nil
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.After(5 * time.Second)
+	for !cond() {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for %s", what)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestElector_Run(t *testing.T) {
+	lock := &fakeLock{}
+	elector := leader.NewElector(lock, "replica-1", "fake", 30*time.Millisecond)
+
+	var mu sync.Mutex
+	running, terms := false, 0
+	isRunning := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return running
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		elector.Run(ctx, func(ctx context.Context) {
+			mu.Lock()
+			running = true
+			terms++
+			mu.Unlock()
+
+			<-ctx.Done()
+
+			mu.Lock()
+			running = false
+			mu.Unlock()
+		})
+		close(stopped)
+	}()
+
+	lock.set(true, nil)
+	waitFor(t, "leadership", func() bool { return isRunning() && elector.IsLeader() })
+
+	lock.set(true, errors.New("connection reset"))
+	waitFor(t, "stepping down after a lock error", func() bool { return !isRunning() && !elector.IsLeader() })
+
+	lock.set(true, nil)
+	waitFor(t, "leadership to be regained", isRunning)
+
+	cancel()
+	<-stopped
+
+	if isRunning() {
+		t.Errorf("fn still running after Run returned")
+	}
+	if terms != 2 {
+		t.Errorf("fn ran %d times, want 2", terms)
+	}
+	if !lock.released {
+		t.Errorf("lock not released on shutdown")
+	}
+}
+
+// hangingLock is taken on the first attempt, after which renewals hang
+// until release is closed, as they do when the database is unreachable.
+// ignoreCtx makes them hang past their context, too.
+type hangingLock struct {
+	ignoreCtx bool
+	release   chan struct{}
+
+	mu       sync.Mutex
+	attempts int
+}
+
+func (l *hangingLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	l.attempts++
+	first := l.attempts == 1
+	l.mu.Unlock()
+	if first {
+		return true, nil
+	}
+
+	if l.ignoreCtx {
+		<-l.release
+		return false, errors.New("connection lost")
+	}
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-l.release:
+		return false, errors.New("connection lost")
+	}
+}
+
+func (l *hangingLock) Release(ctx context.Context) error {
+	return nil
+}
+
+func (l *hangingLock) Holder(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+func TestElector_RenewalHangs(t *testing.T) {
+	const lease = 30 * time.Millisecond
+
+	tests := []struct {
+		name      string
+		ignoreCtx bool
+	}{
+		{name: "attempt times out"},
+		{name: "attempt ignores its deadline", ignoreCtx: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock := &hangingLock{ignoreCtx: tt.ignoreCtx, release: make(chan struct{})}
+			elector := leader.NewElector(lock, "replica-1", "fake", lease)
+
+			started := make(chan time.Time, 1)
+			cancelled := make(chan time.Time, 1)
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			go func() {
+				elector.Run(ctx, func(ctx context.Context) {
+					started <- time.Now()
+					<-ctx.Done()
+					cancelled <- time.Now()
+				})
+				close(stopped)
+			}()
+			defer func() {
+				cancel()
+				close(lock.release)
+				<-stopped
+			}()
+
+			start := <-started
+			select {
+			case end := <-cancelled:
+				// another replica may take over once the lease is out;
+				// allow for some scheduling delay on top
+				if d := end.Sub(start); d > 2*lease {
+					t.Errorf("fn ran %v into a lease of %v that was never renewed", d, lease)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("fn kept running while renewals hung")
+			}
+		})
+	}
+}
+
+func TestElector_ServeHTTP(t *testing.T) {
+	elector := leader.NewElector(&fakeLock{}, "replica-1", "fake", time.Hour)
+
+	rec := httptest.NewRecorder()
+	elector.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/leader", nil))
+
+	var status leader.Status
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	want := leader.Status{ID: "replica-1", Backend: "fake", Holder: "other"}
+	if status != want {
+		t.Errorf("status = %+v, want %+v", status, want)
+	}
+}
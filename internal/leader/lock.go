@@ -0,0 +1,169 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Lock is a lock on leadership that a single replica can hold at a time.
+type Lock interface {
+	// TryAcquire takes the lock, or confirms it is still held, without
+	// blocking. It reports whether this replica holds the lock.
+	TryAcquire(ctx context.Context) (bool, error)
+	// Release gives the lock up so that another replica can take over
+	// without waiting for it to expire.
+	Release(ctx context.Context) error
+	// Holder returns the ID of the replica holding the lock, or "" if it is
+	// not held or the lock cannot tell.
+	Holder(ctx context.Context) (string, error)
+}
+
+// AdvisoryLock holds a Postgres session advisory lock on a dedicated
+// connection. Postgres drops the lock as soon as that connection goes away,
+// so a crashed leader is replaced as soon as its connection is closed.
+type AdvisoryLock struct {
+	db  *sql.DB
+	key int64
+
+	mu   sync.Mutex
+	conn *sql.Conn
+	held bool
+}
+
+var _ Lock = (*AdvisoryLock)(nil)
+
+func NewAdvisoryLock(db *sql.DB, name string) *AdvisoryLock {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+
+	return &AdvisoryLock{
+		db:  db,
+		key: int64(h.Sum64()),
+	}
+}
+
+func (l *AdvisoryLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		conn, err := l.db.Conn(ctx)
+		if err != nil {
+			return false, err
+		}
+		l.conn = conn
+	}
+
+	if l.held {
+		// the lock lives as long as the session; make sure it is still there
+		if _, err := l.conn.ExecContext(ctx, "SELECT 1"); err != nil {
+			l.reset()
+			return false, err
+		}
+		return true, nil
+	}
+
+	if err := l.conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&l.held); err != nil {
+		l.reset()
+		return false, err
+	}
+	return l.held, nil
+}
+
+func (l *AdvisoryLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+	defer l.reset()
+
+	if !l.held {
+		return nil
+	}
+	_, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key)
+	return err
+}
+
+// Holder is not supported by advisory locks, which do not record who holds
+// them.
+func (l *AdvisoryLock) Holder(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+// reset closes the session, which also drops the lock if it was held.
+func (l *AdvisoryLock) reset() {
+	l.conn.Close()
+	l.conn = nil
+	l.held = false
+}
+
+// LeaseLock is a lease row in leader_leases that the holder renews before it
+// expires. It works through connection poolers, but a crashed leader is only
+// replaced once its lease has run out.
+type LeaseLock struct {
+	db     *sql.DB
+	name   string
+	holder string
+	ttl    time.Duration
+}
+
+var _ Lock = (*LeaseLock)(nil)
+
+func NewLeaseLock(db *sql.DB, name, holder string, ttl time.Duration) *LeaseLock {
+	return &LeaseLock{
+		db:     db,
+		name:   name,
+		holder: holder,
+		ttl:    ttl,
+	}
+}
+
+func (l *LeaseLock) TryAcquire(ctx context.Context) (bool, error) {
+	// take the lease if it is free, ours, or expired
+	var holder string
+	err := l.db.QueryRowContext(ctx, `
+        INSERT INTO leader_leases (name, holder, expiresat)
+        VALUES ($1, $2, NOW() + $3 * INTERVAL '1 second')
+        ON CONFLICT (name) DO UPDATE
+        SET holder = EXCLUDED.holder, expiresat = EXCLUDED.expiresat
+        WHERE leader_leases.holder = EXCLUDED.holder OR leader_leases.expiresat < NOW()
+        RETURNING holder
+    `, l.name, l.holder, l.ttl.Seconds()).Scan(&holder)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *LeaseLock) Release(ctx context.Context) error {
+	_, err := l.db.ExecContext(ctx, "DELETE FROM leader_leases WHERE name = $1 AND holder = $2", l.name, l.holder)
+	return err
+}
+
+func (l *LeaseLock) Holder(ctx context.Context) (string, error) {
+	var holder string
+	err := l.db.QueryRowContext(ctx, "SELECT holder FROM leader_leases WHERE name = $1 AND expiresat > NOW()", l.name).Scan(&holder)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return holder, err
+}
+
+// NoopLock is always held. It is for running a single replica without
+// leader election.
+type NoopLock struct{}
+
+var _ Lock = NoopLock{}
+
+func (NoopLock) TryAcquire(ctx context.Context) (bool, error) { return true, nil }
+func (NoopLock) Release(ctx context.Context) error            { return nil }
+func (NoopLock) Holder(ctx context.Context) (string, error)   { return "", nil }
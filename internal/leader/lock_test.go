@@ -0,0 +1,127 @@
+package leader_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nabutabu/crane-oss/internal/leader"
+)
+
+func TestLeaseLock_TryAcquire(t *testing.T) {
+	tests := []struct {
+		name     string
+		rows     *sqlmock.Rows
+		wantHeld bool
+	}{
+		{
+			name:     "free, expired or ours",
+			rows:     sqlmock.NewRows([]string{"holder"}).AddRow("replica-1"),
+			wantHeld: true,
+		},
+		{
+			name:     "held by another replica",
+			rows:     sqlmock.NewRows([]string{"holder"}),
+			wantHeld: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, _ := sqlmock.New()
+			defer db.Close()
+			lock := leader.NewLeaseLock(db, leader.LockName, "replica-1", 15*time.Second)
+
+			mock.ExpectQuery("INSERT INTO leader_leases").
+				WithArgs(leader.LockName, "replica-1", 15.0).
+				WillReturnRows(tt.rows)
+
+			held, err := lock.TryAcquire(context.Background())
+			if err != nil {
+				t.Fatalf("TryAcquire() failed: %v", err)
+			}
+			if held != tt.wantHeld {
+				t.Errorf("TryAcquire() = %v, want %v", held, tt.wantHeld)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestLeaseLock_Holder(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	lock := leader.NewLeaseLock(db, leader.LockName, "replica-1", 15*time.Second)
+
+	mock.ExpectQuery("SELECT holder FROM leader_leases").
+		WithArgs(leader.LockName).
+		WillReturnRows(sqlmock.NewRows([]string{"holder"}).AddRow("replica-2"))
+	mock.ExpectExec("DELETE FROM leader_leases").
+		WithArgs(leader.LockName, "replica-1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	holder, err := lock.Holder(context.Background())
+	if err != nil || holder != "replica-2" {
+		t.Errorf("Holder() = %q, %v; want replica-2", holder, err)
+	}
+	if err := lock.Release(context.Background()); err != nil {
+		t.Errorf("Release() failed: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAdvisoryLock(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	lock := leader.NewAdvisoryLock(db, leader.LockName)
+	ctx := context.Background()
+
+	// another replica holds the lock
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+	if held, err := lock.TryAcquire(ctx); err != nil || held {
+		t.Fatalf("TryAcquire() = %v, %v; want false", held, err)
+	}
+
+	// it went away
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+	if held, err := lock.TryAcquire(ctx); err != nil || !held {
+		t.Fatalf("TryAcquire() = %v, %v; want true", held, err)
+	}
+
+	// while held, TryAcquire only checks that the session is alive
+	mock.ExpectExec("SELECT 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	if held, err := lock.TryAcquire(ctx); err != nil || !held {
+		t.Fatalf("TryAcquire() = %v, %v; want true", held, err)
+	}
+
+	// losing the session loses the lock
+	errConn := errors.New("connection reset")
+	mock.ExpectExec("SELECT 1").WillReturnError(errConn)
+	if held, err := lock.TryAcquire(ctx); !errors.Is(err, errConn) || held {
+		t.Fatalf("TryAcquire() = %v, %v; want false, %v", held, err, errConn)
+	}
+
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+	if held, err := lock.TryAcquire(ctx); err != nil || !held {
+		t.Fatalf("TryAcquire() = %v, %v; want true", held, err)
+	}
+	mock.ExpectExec("SELECT pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := lock.Release(ctx); err != nil {
+		t.Errorf("Release() failed: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
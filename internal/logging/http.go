@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/httputil"
+)
+
+// RequestIDHeader carries the request ID in requests and responses.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs taken from clients.
+const maxRequestIDLength = 128
+
+// Middleware gives every request an ID, taken from the X-Request-ID header
+// when the client sent one, echoes it in the response, and logs the request
+// once it has been served.
+func Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := WithRequestID(r.Context(), id)
+		r = r.WithContext(ctx)
+
+		start := time.Now()
+		rec := httputil.NewStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		logger.InfoContext(ctx, "http request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.Status,
+			"duration", time.Since(start),
+		)
+	})
+}
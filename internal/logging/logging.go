@@ -0,0 +1,103 @@
+// Package logging sets up crane's structured logs and carries the request ID
+// that ties together the log lines of everything one API call sets off.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Field names shared by every component, so that lines about the same host
+// or action can be found across them.
+const (
+	KeyRequestID = "request_id"
+	KeyHostID    = "host_id"
+	KeyActionID  = "action_id"
+	KeyTraceID   = "trace_id"
+)
+
+// New returns a logger writing to w in format, "json" or "text", at level
+// and above. Lines logged with a context carrying a request ID include it.
+func New(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch format {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(s))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// contextHandler adds the request ID and trace ID of the context a line is
+// logged with.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String(KeyRequestID, id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		record.AddAttrs(slog.String(KeyTraceID, sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Discard returns a logger that drops everything, for tests.
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
@@ -0,0 +1,107 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nabutabu/crane-oss/internal/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNew_RequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "json", slog.LevelInfo)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9},
+		SpanID:  trace.SpanID{0x01},
+	}))
+	logger.With(logging.KeyHostID, "host-1").InfoContext(ctx, "drained")
+	logger.DebugContext(ctx, "below the level")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("want a single JSON line, got %q: %v", buf.String(), err)
+	}
+	if line[logging.KeyRequestID] != "req-1" || line[logging.KeyHostID] != "host-1" || line["msg"] != "drained" {
+		t.Errorf("logged %v", line)
+	}
+	if line[logging.KeyTraceID] != "4bf90000000000000000000000000000" {
+		t.Errorf("logged trace ID %v", line[logging.KeyTraceID])
+	}
+}
+
+func TestNew_UnknownFormat(t *testing.T) {
+	if _, err := logging.New(&bytes.Buffer{}, "xml", slog.LevelInfo); err == nil {
+		t.Error("New() accepted an unknown format")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    slog.Level
+		wantErr bool
+	}{
+		{in: "debug", want: slog.LevelDebug},
+		{in: "INFO", want: slog.LevelInfo},
+		{in: "warn", want: slog.LevelWarn},
+		{in: "error", want: slog.LevelError},
+		{in: "loud", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := logging.ParseLevel(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLevel(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLevel(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "uses the client's ID", header: "req-1", want: "req-1"},
+		{name: "generates an ID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := logging.Middleware(logging.Discard(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = logging.RequestID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/hosts", nil)
+			if tt.header != "" {
+				req.Header.Set(logging.RequestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if seen == "" || (tt.want != "" && seen != tt.want) {
+				t.Errorf("handler saw request ID %q, want %q", seen, tt.want)
+			}
+			if got := rec.Header().Get(logging.RequestIDHeader); got != seen {
+				t.Errorf("response %s = %q, want %q", logging.RequestIDHeader, got, seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Package metrics exposes crane's Prometheus metrics. Counters and
+// histograms live next to the code they instrument; this package adds the
+// gauges read from the database at scrape time and instruments the HTTP API.
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/execute"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/pkg/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrapeTimeout bounds the database queries made for a single scrape.
+const scrapeTimeout = 5 * time.Second
+
+// HostSummarizer is the part of the host store the Collector reads.
+type HostSummarizer interface {
+	Summary(ctx context.Context) ([]store.HostSummary, error)
+	OldestInState(ctx context.Context) (map[api.HostState]time.Time, error)
+}
+
+// ActionSummarizer is the part of the action store the Collector reads.
+type ActionSummarizer interface {
+	Backlog(ctx context.Context) ([]execute.ActionBacklog, error)
+}
+
+var (
+	hostsDesc = prometheus.NewDesc(
+		"crane_hosts",
+		"Hosts in the catalog, by state, health, role and zone.",
+		[]string{"state", "health", "role", "zone"}, nil,
+	)
+	hostStateAgeDesc = prometheus.NewDesc(
+		"crane_host_state_max_age_seconds",
+		"How long the host that has been in a state longest has been in it, by state.",
+		[]string{"state"}, nil,
+	)
+	actionsDesc = prometheus.NewDesc(
+		"crane_actions",
+		"Pending and running actions, by type and status.",
+		[]string{"type", "status"}, nil,
+	)
+	oldestPendingDesc = prometheus.NewDesc(
+		"crane_actions_oldest_pending_age_seconds",
+		"Age of the oldest pending action, by type.",
+		[]string{"type"}, nil,
+	)
+	scrapeErrorDesc = prometheus.NewDesc(
+		"crane_catalog_scrape_error",
+		"1 if reading the catalog for the last scrape failed, 0 otherwise.",
+		nil, nil,
+	)
+)
+
+// Collector reports the state of the host catalog and the action queue as
+// gauges, read from the stores on every scrape.
+type Collector struct {
+	hosts   HostSummarizer
+	actions ActionSummarizer
+	// Logger defaults to slog.Default.
+	Logger *slog.Logger
+}
+
+func NewCollector(hosts HostSummarizer, actions ActionSummarizer) *Collector {
+	return &Collector{
+		hosts:   hosts,
+		actions: actions,
+	}
+}
+
+func (c *Collector) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.Default()
+	}
+	return c.Logger
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hostsDesc
+	ch <- hostStateAgeDesc
+	ch <- actionsDesc
+	ch <- oldestPendingDesc
+	ch <- scrapeErrorDesc
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	failed := 0.0
+	if err := c.collect(ctx, ch); err != nil {
+		c.logger().ErrorContext(ctx, "metrics: read catalog", "error", err)
+		failed = 1
+	}
+	ch <- prometheus.MustNewConstMetric(scrapeErrorDesc, prometheus.GaugeValue, failed)
+}
+
+func (c *Collector) collect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	now := time.Now()
+
+	summary, err := c.hosts.Summary(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range summary {
+		ch <- prometheus.MustNewConstMetric(hostsDesc, prometheus.GaugeValue, float64(s.Count),
+			string(s.State), string(s.Health), s.Role, s.Zone)
+	}
+
+	oldest, err := c.hosts.OldestInState(ctx)
+	if err != nil {
+		return err
+	}
+	for state, since := range oldest {
+		ch <- prometheus.MustNewConstMetric(hostStateAgeDesc, prometheus.GaugeValue, now.Sub(since).Seconds(), string(state))
+	}
+
+	backlog, err := c.actions.Backlog(ctx)
+	if err != nil {
+		return err
+	}
+	for _, b := range backlog {
+		ch <- prometheus.MustNewConstMetric(actionsDesc, prometheus.GaugeValue, float64(b.Count), string(b.Type), string(b.Status))
+		if b.Status == execute.ActionPending {
+			ch <- prometheus.MustNewConstMetric(oldestPendingDesc, prometheus.GaugeValue, now.Sub(b.Oldest).Seconds(), string(b.Type))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/execute"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/internal/metrics"
+	"github.com/nabutabu/crane-oss/pkg/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeHosts struct {
+	summary []store.HostSummary
+	oldest  map[api.HostState]time.Time
+	err     error
+}
+
+func (f *fakeHosts) Summary(ctx context.Context) ([]store.HostSummary, error) {
+	return f.summary, f.err
+}
+
+func (f *fakeHosts) OldestInState(ctx context.Context) (map[api.HostState]time.Time, error) {
+	return f.oldest, f.err
+}
+
+type fakeActions struct {
+	backlog []execute.ActionBacklog
+}
+
+func (f *fakeActions) Backlog(ctx context.Context) ([]execute.ActionBacklog, error) {
+	return f.backlog, nil
+}
+
+func TestCollector(t *testing.T) {
+	hosts := &fakeHosts{
+		summary: []store.HostSummary{
+			{State: api.HostReady, Health: api.HostHealthHealthy, Role: "worker", Zone: "a", Count: 3},
+			{State: api.HostDraining, Health: api.HostHealthHealthy, Role: "worker", Zone: "b", Count: 1},
+		},
+	}
+	actions := &fakeActions{
+		backlog: []execute.ActionBacklog{
+			{Type: execute.ActionDrainHost, Status: execute.ActionPending, Count: 4, Oldest: time.Now()},
+			{Type: execute.ActionDrainHost, Status: execute.ActionRunning, Count: 1, Oldest: time.Now()},
+		},
+	}
+	collector := metrics.NewCollector(hosts, actions)
+
+	want := `
+# HELP crane_hosts Hosts in the catalog, by state, health, role and zone.
+# TYPE crane_hosts gauge
+crane_hosts{health="healthy",role="worker",state="DRAINING",zone="b"} 1
+crane_hosts{health="healthy",role="worker",state="READY",zone="a"} 3
+# HELP crane_actions Pending and running actions, by type and status.
+# TYPE crane_actions gauge
+crane_actions{status="pending",type="drain_host"} 4
+crane_actions{status="running",type="drain_host"} 1
+# HELP crane_catalog_scrape_error 1 if reading the catalog for the last scrape failed, 0 otherwise.
+# TYPE crane_catalog_scrape_error gauge
+crane_catalog_scrape_error 0
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want), "crane_hosts", "crane_actions", "crane_catalog_scrape_error"); err != nil {
+		t.Error(err)
+	}
+	// one pending type
+	if n := testutil.CollectAndCount(collector, "crane_actions_oldest_pending_age_seconds"); n != 1 {
+		t.Errorf("oldest pending age series = %d, want 1", n)
+	}
+}
+
+func TestCollector_StateAge(t *testing.T) {
+	hosts := &fakeHosts{
+		oldest: map[api.HostState]time.Time{api.HostDraining: time.Now().Add(-time.Hour)},
+	}
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(metrics.NewCollector(hosts, &fakeActions{}))
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() failed: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "crane_host_state_max_age_seconds" {
+			continue
+		}
+		m := family.GetMetric()
+		if len(m) != 1 || m[0].GetLabel()[0].GetValue() != "DRAINING" {
+			t.Fatalf("state age = %v, want a single DRAINING series", m)
+		}
+		if age := m[0].GetGauge().GetValue(); age < 3600 || age > 3660 {
+			t.Errorf("DRAINING age = %fs, want about an hour", age)
+		}
+		return
+	}
+	t.Error("crane_host_state_max_age_seconds not collected")
+}
+
+func TestCollector_Error(t *testing.T) {
+	collector := metrics.NewCollector(&fakeHosts{err: errors.New("db down")}, &fakeActions{})
+
+	want := `
+# HELP crane_catalog_scrape_error 1 if reading the catalog for the last scrape failed, 0 otherwise.
+# TYPE crane_catalog_scrape_error gauge
+crane_catalog_scrape_error 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
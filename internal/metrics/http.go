@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/httputil"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "crane_http_request_duration_seconds",
+	Help:    "Latency of HTTP requests, by method, route pattern and status code.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"method", "route", "code"})
+
+// Handler serves every registered metric in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Instrument records the latency of every request served by mux. Requests
+// are labelled with the pattern they matched rather than their path, so
+// host IDs do not end up in label values.
+func Instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := httputil.NewStatusRecorder(w)
+
+		mux.ServeHTTP(rec, r)
+
+		// ServeMux sets the pattern on the request it routes
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		httpDuration.WithLabelValues(r.Method, route, strconv.Itoa(rec.Status)).Observe(time.Since(start).Seconds())
+	})
+}
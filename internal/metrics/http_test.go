@@ -0,0 +1,39 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nabutabu/crane-oss/internal/metrics"
+)
+
+func TestInstrument(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/hosts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.Handle("GET /metrics", metrics.Handler())
+	handler := metrics.Instrument(mux)
+
+	for _, path := range []string{"/v1/hosts/host-1", "/v1/hosts/host-2", "/nowhere"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`crane_http_request_duration_seconds_count{code="404",method="GET",route="GET /v1/hosts/{id}"} 2`,
+		`crane_http_request_duration_seconds_count{code="404",method="GET",route="unmatched"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+	if strings.Contains(body, "host-1") {
+		t.Error("host ID leaked into label values")
+	}
+}
@@ -0,0 +1,259 @@
+// Package migrate applies the versioned SQL migrations that define the
+// crane schema. Migrations live in migrations/ as NNNN_name.up.sql and
+// NNNN_name.down.sql pairs and are embedded into the binary.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	DB *sql.DB
+	// Logger defaults to slog.Default.
+	Logger     *slog.Logger
+	migrations []Migration
+}
+
+// New returns a Migrator for the migrations embedded in the binary.
+func New(DB *sql.DB) (*Migrator, error) {
+	migrations, err := Load(migrationFS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		DB:         DB,
+		migrations: migrations,
+	}, nil
+}
+
+func (m *Migrator) logger() *slog.Logger {
+	if m.Logger == nil {
+		return slog.Default()
+	}
+	return m.Logger
+}
+
+// Load reads every migration in the migrations directory of fsys, ordered by
+// version. Each version must have both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql suffix", name)
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		num, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name", name)
+		}
+		version, err := strconv.Atoi(num)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", name, err)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, label)
+		}
+
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s is missing its up or down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+
+	return migrations, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.DB.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := m.DB.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
+
+// Up applies every pending migration in order and returns the ones it
+// applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		m.logger().InfoContext(ctx, "applying migration", "version", migration.Version, "name", migration.Name)
+		err := m.inTx(ctx, migration.Up,
+			"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+		if err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down rolls back the most recently applied migration. It returns nil if
+// nothing has been applied.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		m.logger().InfoContext(ctx, "rolling back migration", "version", migration.Version, "name", migration.Name)
+		err := m.inTx(ctx, migration.Down,
+			"DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+		if err != nil {
+			return nil, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return &migration, nil
+	}
+
+	return nil, nil
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		at, ok := applied[migration.Version]
+		statuses[i] = MigrationStatus{
+			Migration: migration,
+			Applied:   ok,
+			AppliedAt: at,
+		}
+	}
+
+	return statuses, nil
+}
+
+// inTx runs a migration script and its schema_migrations bookkeeping
+// statement in a single transaction.
+func (m *Migrator) inTx(ctx context.Context, script string, bookkeeping string, args ...any) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
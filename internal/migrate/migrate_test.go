@@ -0,0 +1,126 @@
+package migrate_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/nabutabu/crane-oss/internal/migrate"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int
+		wantErr  bool
+	}{
+		{
+			name: "orders migrations by version",
+			files: fstest.MapFS{
+				"migrations/0002_b.up.sql":   {Data: []byte("CREATE TABLE b ()")},
+				"migrations/0002_b.down.sql": {Data: []byte("DROP TABLE b")},
+				"migrations/0001_a.up.sql":   {Data: []byte("CREATE TABLE a ()")},
+				"migrations/0001_a.down.sql": {Data: []byte("DROP TABLE a")},
+			},
+			versions: []int{1, 2},
+		},
+		{
+			name: "missing down file",
+			files: fstest.MapFS{
+				"migrations/0001_a.up.sql": {Data: []byte("CREATE TABLE a ()")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unexpected file name",
+			files: fstest.MapFS{
+				"migrations/schema.sql": {Data: []byte("CREATE TABLE a ()")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := migrate.Load(tt.files)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(migrations) != len(tt.versions) {
+				t.Fatalf("Load() returned %d migrations, want %d", len(migrations), len(tt.versions))
+			}
+			for i, m := range migrations {
+				if m.Version != tt.versions[i] {
+					t.Errorf("migration %d has version %d, want %d", i, m.Version, tt.versions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNew_LoadsEmbeddedMigrations(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := migrate.New(db); err != nil {
+		t.Fatalf("embedded migrations failed to load: %v", err)
+	}
+}
+
+func TestMigrator_Up(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}))
+
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status() failed: %v", err)
+	}
+	if len(statuses) < 2 {
+		t.Fatalf("expected at least two embedded migrations, got %d", len(statuses))
+	}
+
+	// the first migration is already applied, everything after it is pending
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(statuses[0].Version, time.Now()))
+	for _, s := range statuses[1:] {
+		mock.ExpectBegin()
+		mock.ExpectExec(`.+`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`INSERT INTO schema_migrations \(version, name\) VALUES \(\$1, \$2\)`).
+			WithArgs(s.Version, s.Name).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		t.Fatalf("Up() failed: %v", err)
+	}
+	if len(applied) != len(statuses)-1 {
+		t.Errorf("Up() applied %d migrations, want %d", len(applied), len(statuses)-1)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet sql expectations: %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+CREATE TABLE host (
+    id         TEXT PRIMARY KEY,
+    hostname   TEXT NOT NULL DEFAULT '',
+    provider   TEXT NOT NULL DEFAULT '',
+    providerid TEXT NOT NULL DEFAULT '',
+    role       TEXT NOT NULL,
+    zone       TEXT NOT NULL,
+    fleet      TEXT NOT NULL DEFAULT '',
+    imageid    TEXT NOT NULL,
+    state      TEXT NOT NULL CHECK (state IN ('PROVISIONING', 'READY', 'DRAINING', 'TERMINATED', 'UNHEALTHY')),
+    health     TEXT NOT NULL CHECK (health IN ('unknown', 'healthy', 'unhealthy')),
+    createdat  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- keyset pagination in PostgresHostStore.List orders by (createdat, id)
+CREATE INDEX host_createdat_id_idx ON host (createdat, id);
+CREATE INDEX host_state_createdat_id_idx ON host (state, createdat, id);
+CREATE INDEX host_fleet_role_zone_idx ON host (fleet, role, zone);
@@ -0,0 +1,13 @@
+CREATE TABLE actions (
+    id        BIGSERIAL PRIMARY KEY,
+    hostid    TEXT NOT NULL,
+    type      TEXT NOT NULL,
+    status    TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'done', 'failed')),
+    attempts  INTEGER NOT NULL DEFAULT 0,
+    createdat TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updatedat TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- serves PostgresActionStore.Next: WHERE status = 'pending' ORDER BY createdat
+CREATE INDEX actions_pending_createdat_idx ON actions (createdat) WHERE status = 'pending';
+CREATE INDEX actions_hostid_idx ON actions (hostid);
@@ -0,0 +1 @@
+ALTER TABLE host DROP COLUMN version;
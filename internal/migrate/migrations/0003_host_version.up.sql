@@ -0,0 +1,4 @@
+-- version is bumped on every write and checked by state transitions so that
+-- concurrent writers cannot both apply a transition they validated against
+-- the same snapshot.
+ALTER TABLE host ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,14 @@
+CREATE TABLE host_events (
+    id        BIGSERIAL PRIMARY KEY,
+    hostid    TEXT NOT NULL,
+    field     TEXT NOT NULL CHECK (field IN ('state', 'health')),
+    oldvalue  TEXT NOT NULL,
+    newvalue  TEXT NOT NULL,
+    actor     TEXT NOT NULL DEFAULT '',
+    reason    TEXT NOT NULL DEFAULT '',
+    createdat TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- events outlive their host so the history of decommissioned hosts can
+-- still be inspected; hence no foreign key.
+CREATE INDEX host_events_hostid_createdat_idx ON host_events (hostid, createdat, id);
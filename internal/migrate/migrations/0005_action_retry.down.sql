@@ -0,0 +1,9 @@
+UPDATE actions SET status = 'failed' WHERE status = 'dead';
+
+ALTER TABLE actions DROP CONSTRAINT actions_status_check;
+ALTER TABLE actions ADD CONSTRAINT actions_status_check
+    CHECK (status IN ('pending', 'running', 'done', 'failed'));
+
+ALTER TABLE actions
+    DROP COLUMN notbefore,
+    DROP COLUMN lasterror;
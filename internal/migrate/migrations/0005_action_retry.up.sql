@@ -0,0 +1,9 @@
+-- lasterror keeps the error of the most recent attempt; notbefore delays
+-- retries, Next only claims pending actions whose notbefore has passed.
+ALTER TABLE actions
+    ADD COLUMN lasterror TEXT NOT NULL DEFAULT '',
+    ADD COLUMN notbefore TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+ALTER TABLE actions DROP CONSTRAINT actions_status_check;
+ALTER TABLE actions ADD CONSTRAINT actions_status_check
+    CHECK (status IN ('pending', 'running', 'done', 'failed', 'dead'));
@@ -0,0 +1,5 @@
+DROP INDEX actions_running_leaseexpiresat_idx;
+
+ALTER TABLE actions
+    DROP COLUMN leaseexpiresat,
+    DROP COLUMN workerid;
@@ -0,0 +1,9 @@
+-- A running action is leased to the worker that claimed it until
+-- leaseexpiresat. Workers extend the lease while they execute; the janitor
+-- returns actions whose lease ran out to the queue.
+ALTER TABLE actions
+    ADD COLUMN workerid TEXT NOT NULL DEFAULT '',
+    ADD COLUMN leaseexpiresat TIMESTAMPTZ;
+
+-- serves PostgresActionStore.ReclaimExpired
+CREATE INDEX actions_running_leaseexpiresat_idx ON actions (leaseexpiresat) WHERE status = 'running';
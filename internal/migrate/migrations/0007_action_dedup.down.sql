@@ -0,0 +1 @@
+DROP INDEX actions_hostid_active_idx;
@@ -0,0 +1,17 @@
+-- Earlier versions enqueued an action for every host on every reconcile.
+-- Keep the oldest active action per host, preferring one that is already
+-- running, and fail the rest so that the unique index below can be built.
+UPDATE actions
+SET status = 'failed', lasterror = 'duplicate of action ' || keep.id, updatedat = NOW()
+FROM (
+    SELECT DISTINCT ON (hostid) hostid, id
+    FROM actions
+    WHERE status IN ('pending', 'running')
+    ORDER BY hostid, status = 'running' DESC, createdat, id
+) keep
+WHERE actions.hostid = keep.hostid
+  AND actions.status IN ('pending', 'running')
+  AND actions.id <> keep.id;
+
+-- a host has at most one active action
+CREATE UNIQUE INDEX actions_hostid_active_idx ON actions (hostid) WHERE status IN ('pending', 'running');
@@ -0,0 +1,7 @@
+-- Backs leader.LeaseLock, the leader election used where session advisory
+-- locks are unreliable, e.g. behind a transaction-pooling proxy.
+CREATE TABLE leader_leases (
+    name      TEXT PRIMARY KEY,
+    holder    TEXT NOT NULL,
+    expiresat TIMESTAMPTZ NOT NULL
+);
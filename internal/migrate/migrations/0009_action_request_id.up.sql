@@ -0,0 +1,4 @@
+-- The request ID of the API call or reconcile that enqueued an action, so
+-- that the worker's log lines can be tied back to it.
+ALTER TABLE actions
+    ADD COLUMN requestid TEXT NOT NULL DEFAULT '';
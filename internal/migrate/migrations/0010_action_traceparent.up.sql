@@ -0,0 +1,4 @@
+-- The W3C traceparent of the span that enqueued an action, so that the
+-- worker's spans continue the trace of the reconcile that caused it.
+ALTER TABLE actions
+    ADD COLUMN traceparent TEXT NOT NULL DEFAULT '';
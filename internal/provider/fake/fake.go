@@ -0,0 +1,134 @@
+// Package fake is an in-memory provider for running Crane locally. Instances
+// boot after a configurable latency and fail to boot at a configurable rate.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/provider"
+)
+
+// Name is the name the fake provider is conventionally registered under.
+const Name = "fake"
+
+type Config struct {
+	// BootLatency is how long instances stay pending after creation.
+	BootLatency time.Duration
+	// FailureRate is the probability, between 0 and 1, that an instance
+	// fails to boot.
+	FailureRate float64
+}
+
+type instance struct {
+	provider.Instance
+	readyAt time.Time
+	fails   bool
+}
+
+type Provider struct {
+	cfg Config
+
+	mu        sync.Mutex
+	rand      *rand.Rand
+	nextID    int
+	instances map[string]*instance
+}
+
+var _ provider.Provider = (*Provider)(nil)
+
+func New(cfg Config) *Provider {
+	return &Provider{
+		cfg:       cfg,
+		rand:      rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+		instances: make(map[string]*instance),
+	}
+}
+
+func (p *Provider) CreateInstance(ctx context.Context, spec provider.InstanceSpec) (*provider.Instance, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, inst := range p.instances {
+		if inst.HostID == spec.HostID && p.state(inst) != provider.InstanceTerminated {
+			return p.describe(inst), nil
+		}
+	}
+
+	p.nextID++
+	id := fmt.Sprintf("fake-%06d", p.nextID)
+	inst := &instance{
+		Instance: provider.Instance{
+			ID:       id,
+			HostID:   spec.HostID,
+			Hostname: id + ".fake.internal",
+			Zone:     spec.Zone,
+			ImageID:  spec.ImageID,
+			State:    provider.InstancePending,
+		},
+		readyAt: time.Now().Add(p.cfg.BootLatency),
+		fails:   p.rand.Float64() < p.cfg.FailureRate,
+	}
+	p.instances[id] = inst
+
+	return p.describe(inst), nil
+}
+
+func (p *Provider) DeleteInstance(ctx context.Context, id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	inst, ok := p.instances[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", provider.ErrInstanceNotFound, id)
+	}
+	inst.State = provider.InstanceTerminated
+	return nil
+}
+
+func (p *Provider) DescribeInstance(ctx context.Context, id string) (*provider.Instance, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	inst, ok := p.instances[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", provider.ErrInstanceNotFound, id)
+	}
+	return p.describe(inst), nil
+}
+
+func (p *Provider) ListInstances(ctx context.Context) ([]*provider.Instance, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	instances := make([]*provider.Instance, 0, len(p.instances))
+	for _, inst := range p.instances {
+		instances = append(instances, p.describe(inst))
+	}
+	slices.SortFunc(instances, func(a, b *provider.Instance) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return instances, nil
+}
+
+// describe returns a copy of inst with its state as of now.
+func (p *Provider) describe(inst *instance) *provider.Instance {
+	out := inst.Instance
+	out.State = p.state(inst)
+	return &out
+}
+
+func (p *Provider) state(inst *instance) provider.InstanceState {
+	if inst.State != provider.InstancePending || time.Now().Before(inst.readyAt) {
+		return inst.State
+	}
+	if inst.fails {
+		return provider.InstanceFailed
+	}
+	return provider.InstanceRunning
+}
@@ -0,0 +1,96 @@
+package fake_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/provider"
+	"github.com/nabutabu/crane-oss/internal/provider/fake"
+)
+
+func TestProvider_Boot(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  fake.Config
+		want provider.InstanceState
+	}{
+		{name: "still booting", cfg: fake.Config{BootLatency: time.Hour}, want: provider.InstancePending},
+		{name: "booted", cfg: fake.Config{}, want: provider.InstanceRunning},
+		{name: "failed to boot", cfg: fake.Config{FailureRate: 1}, want: provider.InstanceFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			p := fake.New(tt.cfg)
+
+			inst, err := p.CreateInstance(ctx, provider.InstanceSpec{HostID: "host-1", Zone: "us-east-1a", ImageID: "img-1"})
+			if err != nil {
+				t.Fatalf("CreateInstance() failed: %v", err)
+			}
+
+			got, err := p.DescribeInstance(ctx, inst.ID)
+			if err != nil {
+				t.Fatalf("DescribeInstance() failed: %v", err)
+			}
+			if got.State != tt.want {
+				t.Errorf("state = %s, want %s", got.State, tt.want)
+			}
+			if got.HostID != "host-1" || got.Zone != "us-east-1a" || got.ImageID != "img-1" {
+				t.Errorf("instance = %+v, does not match spec", got)
+			}
+		})
+	}
+}
+
+func TestProvider_CreateIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	p := fake.New(fake.Config{})
+	spec := provider.InstanceSpec{HostID: "host-1"}
+
+	first, err := p.CreateInstance(ctx, spec)
+	if err != nil {
+		t.Fatalf("CreateInstance() failed: %v", err)
+	}
+	second, err := p.CreateInstance(ctx, spec)
+	if err != nil {
+		t.Fatalf("CreateInstance() failed: %v", err)
+	}
+	if first.ID != second.ID {
+		t.Errorf("second create returned %s, want existing %s", second.ID, first.ID)
+	}
+
+	// once the instance is gone the host gets a new one
+	if err := p.DeleteInstance(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteInstance() failed: %v", err)
+	}
+	third, err := p.CreateInstance(ctx, spec)
+	if err != nil {
+		t.Fatalf("CreateInstance() failed: %v", err)
+	}
+	if third.ID == first.ID {
+		t.Errorf("create after delete returned terminated instance %s", third.ID)
+	}
+
+	instances, err := p.ListInstances(ctx)
+	if err != nil {
+		t.Fatalf("ListInstances() failed: %v", err)
+	}
+	if len(instances) != 2 || instances[0].State != provider.InstanceTerminated {
+		t.Errorf("ListInstances() = %+v, want terminated %s and %s", instances, first.ID, third.ID)
+	}
+}
+
+func TestProvider_NotFound(t *testing.T) {
+	ctx := context.Background()
+	p := fake.New(fake.Config{})
+
+	if _, err := p.DescribeInstance(ctx, "fake-missing"); !errors.Is(err, provider.ErrInstanceNotFound) {
+		t.Errorf("DescribeInstance() error = %v, want %v", err, provider.ErrInstanceNotFound)
+	}
+	if err := p.DeleteInstance(ctx, "fake-missing"); !errors.Is(err, provider.ErrInstanceNotFound) {
+		t.Errorf("DeleteInstance() error = %v, want %v", err, provider.ErrInstanceNotFound)
+	}
+}
@@ -0,0 +1,103 @@
+// Package provider abstracts the infrastructure hosts run on. Each backend
+// implements Provider and is registered under the name hosts carry in their
+// Provider field.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+var (
+	ErrInstanceNotFound = errors.New("instance not found")
+	ErrUnknownProvider  = errors.New("unknown provider")
+)
+
+type InstanceState string
+
+const (
+	InstancePending    InstanceState = "pending"
+	InstanceRunning    InstanceState = "running"
+	InstanceFailed     InstanceState = "failed"
+	InstanceTerminated InstanceState = "terminated"
+)
+
+// InstanceSpec describes the instance to create. HostID is the catalog ID the
+// instance is created for; providers use it as an idempotency token, so
+// creating an instance for a host that already has a live one returns the
+// existing instance.
+type InstanceSpec struct {
+	HostID   string
+	Role     string
+	Zone     string
+	Fleet    string
+	ImageID  string
+	Capacity api.Capacity
+}
+
+type Instance struct {
+	ID       string
+	HostID   string
+	Hostname string
+	Zone     string
+	ImageID  string
+	State    InstanceState
+}
+
+type Provider interface {
+	CreateInstance(ctx context.Context, spec InstanceSpec) (*Instance, error)
+	// DeleteInstance terminates an instance. It returns ErrInstanceNotFound
+	// if the provider does not know the instance.
+	DeleteInstance(ctx context.Context, id string) error
+	DescribeInstance(ctx context.Context, id string) (*Instance, error)
+	ListInstances(ctx context.Context) ([]*Instance, error)
+}
+
+// Registry maps provider names, as stored in api.Host.Provider, to their
+// implementation.
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[string]Provider)}
+}
+
+// Register adds p under name, replacing any provider already registered
+// under that name.
+func (registry *Registry) Register(name string, p Provider) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.providers[name] = p
+}
+
+func (registry *Registry) Get(name string) (Provider, error) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	p, ok := registry.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, name)
+	}
+	return p, nil
+}
+
+// Names returns the registered provider names in sorted order.
+func (registry *Registry) Names() []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	names := make([]string, 0, len(registry.providers))
+	for name := range registry.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
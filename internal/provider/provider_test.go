@@ -0,0 +1,33 @@
+package provider_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/nabutabu/crane-oss/internal/provider"
+	"github.com/nabutabu/crane-oss/internal/provider/fake"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := provider.NewRegistry()
+	p := fake.New(fake.Config{})
+	registry.Register("b", p)
+	registry.Register("a", fake.New(fake.Config{}))
+
+	got, err := registry.Get("b")
+	if err != nil {
+		t.Fatalf("Get(b) failed: %v", err)
+	}
+	if got != p {
+		t.Errorf("Get(b) = %p, want %p", got, p)
+	}
+
+	if _, err := registry.Get("aws"); !errors.Is(err, provider.ErrUnknownProvider) {
+		t.Errorf("Get(aws) error = %v, want %v", err, provider.ErrUnknownProvider)
+	}
+
+	if names := registry.Names(); !slices.Equal(names, []string{"a", "b"}) {
+		t.Errorf("Names() = %v, want [a b]", names)
+	}
+}
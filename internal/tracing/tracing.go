@@ -0,0 +1,111 @@
+// Package tracing sets up crane's OpenTelemetry traces and carries trace
+// context across the places a context.Context cannot go: host change
+// notifications and the action queue.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies crane-api in trace backends, unless
+// OTEL_SERVICE_NAME says otherwise.
+const ServiceName = "crane-api"
+
+// Attribute keys shared by every component, so that spans about the same
+// host or action can be found across traces. They mirror the logging keys.
+const (
+	KeyRequestID = attribute.Key("crane.request_id")
+	KeyHostID    = attribute.Key("crane.host_id")
+	KeyActionID  = attribute.Key("crane.action_id")
+)
+
+// traceParentKey is the W3C Trace Context header that holds the trace and
+// span a piece of work belongs to.
+const traceParentKey = "traceparent"
+
+// propagator is what TraceParent and WithTraceParent speak. It is also
+// installed globally by Setup, for incoming and outgoing HTTP headers.
+var propagator = propagation.TraceContext{}
+
+// Setup installs the global tracer provider and propagator. exporter is
+// "none", which records nothing, "stdout", which prints spans for local
+// runs, or "otlp", which sends them to the collector configured by the
+// standard OTEL_EXPORTER_OTLP_* variables. The returned function flushes
+// buffered spans and must be called before exiting.
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		spanExporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s trace exporter: %w", exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName())))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func serviceName() string {
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		return name
+	}
+	return ServiceName
+}
+
+// TraceParent returns the traceparent of the span in ctx, or "" if ctx
+// carries none.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier[traceParentKey]
+}
+
+// WithTraceParent returns a copy of ctx whose remote parent span is the one
+// traceParent names. Malformed or empty values leave ctx as it is.
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{traceParentKey: traceParent})
+}
+
+// End ends span, marking it failed if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
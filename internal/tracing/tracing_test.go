@@ -0,0 +1,61 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nabutabu/crane-oss/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTraceParent(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceParent string
+		want        string
+	}{
+		{name: "round trip", traceParent: traceParent, want: traceParent},
+		{name: "empty", traceParent: "", want: ""},
+		{name: "malformed", traceParent: "00-not-a-trace", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tracing.WithTraceParent(context.Background(), tt.traceParent)
+			if got := tracing.TraceParent(ctx); got != tt.want {
+				t.Errorf("TraceParent() = %q, want %q", got, tt.want)
+			}
+			if sc := trace.SpanContextFromContext(ctx); sc.IsValid() != (tt.want != "") {
+				t.Errorf("span context valid = %v, want %v", sc.IsValid(), tt.want != "")
+			}
+		})
+	}
+}
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		exporter string
+		wantErr  bool
+	}{
+		{exporter: "none"},
+		{exporter: "stdout"},
+		{exporter: "zipkin", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.exporter, func(t *testing.T) {
+			shutdown, err := tracing.Setup(context.Background(), tt.exporter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Setup(%q) error = %v, wantErr %v", tt.exporter, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if err := shutdown(context.Background()); err != nil {
+				t.Errorf("shutdown failed: %v", err)
+			}
+		})
+	}
+}
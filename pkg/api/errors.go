@@ -0,0 +1,31 @@
+package api
+
+import "errors"
+
+// Sentinel errors shared by every layer of the host catalog. Errors returned
+// by the store and service wrap one of these, so callers should test for them
+// with errors.Is. The HTTP layer maps each to a status code.
+var (
+	// ErrNotFound means the requested host does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidTransition means the requested state is not a legal next
+	// state for the host.
+	ErrInvalidTransition = errors.New("invalid state transition")
+	// ErrConflict means the host changed underneath the caller, or is in a
+	// state that does not allow the operation.
+	ErrConflict = errors.New("conflict")
+	// ErrValidation means the request itself is malformed.
+	ErrValidation = errors.New("validation failed")
+	// ErrUnavailable means the catalog could not reach its backing store.
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// Problem is an RFC 7807 problem details body, served as
+// application/problem+json for every error response.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
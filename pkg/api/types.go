@@ -14,6 +14,14 @@ const (
 	HostUnhealthy    HostState = "UNHEALTHY"
 )
 
+func (s HostState) Valid() bool {
+	switch s {
+	case HostProvisioning, HostReady, HostDraining, HostTerminated, HostUnhealthy:
+		return true
+	}
+	return false
+}
+
 type CPU string
 
 const (
@@ -27,16 +35,16 @@ const (
 )
 
 type Capacity struct {
-	cpu    CPU
-	memory Memory
+	CPU    CPU    `json:"cpu,omitempty"`
+	Memory Memory `json:"memory,omitempty"`
 }
 
 type Role struct {
-	Name string
+	Name string `json:"name"`
 }
 
 type Fleet struct {
-	name string
+	Name string `json:"name"`
 }
 
 type HostHealth string
@@ -47,21 +55,74 @@ const (
 	HostHealthUnhealthy HostHealth = "unhealthy"
 )
 
+func (h HostHealth) Valid() bool {
+	switch h {
+	case HostHealthUnknown, HostHealthHealthy, HostHealthUnhealthy:
+		return true
+	}
+	return false
+}
+
 type HealthRequest struct {
 	Health string
+	ChangeInfo
+}
+
+// TransitionRequest asks the catalog to move a host to another state, e.g.
+// {"to": "DRAINING", "reason": "kernel upgrade", "actor": "alice"}.
+type TransitionRequest struct {
+	To HostState `json:"to"`
+	ChangeInfo
 }
 
 type Host struct {
-	ID         string
-	HostName   string
-	ProviderID string
-	Provider   string
-	Role       Role
-	Zone       string
-	Fleet      Fleet
-	ImageID    string
-	Capacity   Capacity
-	State      HostState
-	Health     HostHealth
-	CreatedAt  time.Time
+	ID         string     `json:"id"`
+	HostName   string     `json:"hostname"`
+	ProviderID string     `json:"provider_id"`
+	Provider   string     `json:"provider"`
+	Role       Role       `json:"role"`
+	Zone       string     `json:"zone"`
+	Fleet      Fleet      `json:"fleet"`
+	ImageID    string     `json:"image_id"`
+	Capacity   Capacity   `json:"capacity"`
+	State      HostState  `json:"state"`
+	Health     HostHealth `json:"health"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Version is incremented on every change to the host and is used for
+	// optimistic concurrency control.
+	Version int64 `json:"version"`
+}
+
+type HostList struct {
+	Hosts      []*Host `json:"hosts"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// ChangeInfo attributes a change to the catalog for the host history.
+type ChangeInfo struct {
+	Actor  string `json:"actor,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type HostEventField string
+
+const (
+	HostEventState  HostEventField = "state"
+	HostEventHealth HostEventField = "health"
+)
+
+// HostEvent records a single change to a host's state or health.
+type HostEvent struct {
+	ID        int64          `json:"id"`
+	HostID    string         `json:"host_id"`
+	Field     HostEventField `json:"field"`
+	OldValue  string         `json:"old_value"`
+	NewValue  string         `json:"new_value"`
+	Actor     string         `json:"actor,omitempty"`
+	Reason    string         `json:"reason,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type HostHistory struct {
+	Events []*HostEvent `json:"events"`
 }
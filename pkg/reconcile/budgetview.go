@@ -0,0 +1,102 @@
+package reconcile
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+// budgetViewMaxAge is how long per-host reconciles check budgets against the
+// same read of the catalog before reading it again. Resyncs refresh it too.
+const budgetViewMaxAge = 30 * time.Second
+
+// budgetView is what per-host reconciles check disruption budgets against:
+// the catalog and the hosts with an active action as last read, kept up to
+// date with the hosts reconciled and the actions enqueued since. Workers
+// check the budgets again against a fresh read before running an action, so
+// a view that is a little behind cannot cause more disruption than allowed.
+type budgetView struct {
+	hosts     []*api.Host
+	index     map[string]int
+	disrupted map[string]bool
+	readAt    time.Time
+	// enqueued records when hosts were given an action through the view, so
+	// that a refresh racing with the enqueue does not forget it.
+	enqueued map[string]time.Time
+}
+
+func newBudgetView(hosts []*api.Host, disrupted map[string]bool, readAt time.Time) *budgetView {
+	v := &budgetView{
+		hosts:     hosts,
+		index:     make(map[string]int, len(hosts)),
+		disrupted: disrupted,
+		readAt:    readAt,
+		enqueued:  make(map[string]time.Time),
+	}
+	for i, host := range hosts {
+		v.index[host.ID] = i
+	}
+	return v
+}
+
+// update replaces the view's copy of host with a fresher one.
+func (v *budgetView) update(host *api.Host) {
+	if i, ok := v.index[host.ID]; ok {
+		v.hosts[i] = host
+		return
+	}
+	v.index[host.ID] = len(v.hosts)
+	v.hosts = append(v.hosts, host)
+}
+
+// markEnqueued records that host id was given an action.
+func (v *budgetView) markEnqueued(id string) {
+	v.disrupted[id] = true
+	v.enqueued[id] = time.Now()
+}
+
+// refreshBudgetView reads the catalog and the active actions, and makes them
+// the view budget checks are made against. Unless force is set, a view that
+// is fresh enough is kept; several workers may find it stale at once, and
+// one read is enough. It returns the hosts read, if any.
+func (r *DefaultHostReconciler) refreshBudgetView(ctx context.Context, force bool) ([]*api.Host, error) {
+	r.refreshMu.Lock()
+	defer r.refreshMu.Unlock()
+	if !force && !r.budgetViewStale() {
+		return nil, nil
+	}
+
+	start := time.Now()
+	hosts, err := store.ListAll(ctx, r.store, store.HostQuery{})
+	if err != nil {
+		return nil, err
+	}
+	disrupted, err := r.disrupted(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	view := newBudgetView(append([]*api.Host(nil), hosts...), disrupted, start)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.view != nil {
+		// actions enqueued after the read started may be missing from it
+		for id, at := range r.view.enqueued {
+			if !at.Before(start) {
+				view.markEnqueued(id)
+			}
+		}
+	}
+	r.view = view
+	return hosts, nil
+}
+
+// budgetViewStale reports whether there is no view or it is too old to check
+// budgets against.
+func (r *DefaultHostReconciler) budgetViewStale() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.view == nil || time.Since(r.view.readAt) >= budgetViewMaxAge
+}
@@ -13,22 +13,61 @@ const (
 	DecisionReplace ReconcileDecision = "replace"
 )
 
-func Decide(host *api.Host) *execute.Action {
-	// for a given host decide what to do given host.Health and host.Status
-	if host.Health == api.HostHealthHealthy && (host.State == api.HostReady || host.State == api.HostDraining) {
-		return &execute.Action{
-			HostID: host.ID,
-			Type:   execute.ActionDrainHost,
-		}
-	} else if host.Health == api.HostHealthUnhealthy && (host.State == api.HostReady || host.State == api.HostDraining) {
-		return &execute.Action{
-			HostID: host.ID,
-			Type:   execute.ActionReplaceHost,
-		}
+// Action returns the action that carries out d for host id, or nil for
+// DecisionNone.
+func (d ReconcileDecision) Action(id string) *execute.Action {
+	switch d {
+	case DecisionDrain:
+		return &execute.Action{HostID: id, Type: execute.ActionDrainHost}
+	case DecisionReplace:
+		return &execute.Action{HostID: id, Type: execute.ActionReplaceHost}
 	}
+	return nil
+}
+
+// Policy decides what the reconciler should do about a host. Along with the
+// decision it returns a human readable reason, which is logged and shown in
+// plans.
+type Policy interface {
+	Decide(host *api.Host) (ReconcileDecision, string)
+}
+
+// PolicyFunc adapts a function to Policy.
+type PolicyFunc func(host *api.Host) (ReconcileDecision, string)
 
-	return &execute.Action{
-		HostID: host.ID,
-		Type:   execute.ActionDrainHost,
+func (f PolicyFunc) Decide(host *api.Host) (ReconcileDecision, string) {
+	return f(host)
+}
+
+// DefaultPolicy leaves healthy hosts alone, replaces unhealthy ones and
+// finishes drains that are already underway. Hosts that are provisioning or
+// terminated are never touched.
+type DefaultPolicy struct{}
+
+func (DefaultPolicy) Decide(host *api.Host) (ReconcileDecision, string) {
+	switch host.State {
+	case api.HostProvisioning:
+		return DecisionNone, "host is still provisioning"
+	case api.HostTerminated:
+		return DecisionNone, "host is terminated"
+	case api.HostDraining:
+		return DecisionDrain, "finish drain in progress"
+	case api.HostUnhealthy:
+		return DecisionReplace, "host is UNHEALTHY"
+	case api.HostReady:
+		switch host.Health {
+		case api.HostHealthUnhealthy:
+			return DecisionReplace, "READY host reports unhealthy"
+		case api.HostHealthHealthy:
+			return DecisionNone, "host is healthy"
+		default:
+			return DecisionNone, "host health is unknown"
+		}
 	}
+	return DecisionNone, "unknown state " + string(host.State)
+}
+
+// Decide applies DefaultPolicy to host.
+func Decide(host *api.Host) (ReconcileDecision, string) {
+	return DefaultPolicy{}.Decide(host)
 }
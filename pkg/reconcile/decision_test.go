@@ -0,0 +1,66 @@
+package reconcile_test
+
+import (
+	"testing"
+
+	"github.com/nabutabu/crane-oss/internal/execute"
+	"github.com/nabutabu/crane-oss/pkg/api"
+	"github.com/nabutabu/crane-oss/pkg/reconcile"
+)
+
+func TestDefaultPolicy_Decide(t *testing.T) {
+	tests := []struct {
+		state  api.HostState
+		health api.HostHealth
+		want   reconcile.ReconcileDecision
+	}{
+		{state: api.HostProvisioning, health: api.HostHealthUnknown, want: reconcile.DecisionNone},
+		{state: api.HostProvisioning, health: api.HostHealthHealthy, want: reconcile.DecisionNone},
+		{state: api.HostProvisioning, health: api.HostHealthUnhealthy, want: reconcile.DecisionNone},
+		{state: api.HostReady, health: api.HostHealthUnknown, want: reconcile.DecisionNone},
+		{state: api.HostReady, health: api.HostHealthHealthy, want: reconcile.DecisionNone},
+		{state: api.HostReady, health: api.HostHealthUnhealthy, want: reconcile.DecisionReplace},
+		{state: api.HostDraining, health: api.HostHealthUnknown, want: reconcile.DecisionDrain},
+		{state: api.HostDraining, health: api.HostHealthHealthy, want: reconcile.DecisionDrain},
+		{state: api.HostDraining, health: api.HostHealthUnhealthy, want: reconcile.DecisionDrain},
+		{state: api.HostUnhealthy, health: api.HostHealthUnknown, want: reconcile.DecisionReplace},
+		{state: api.HostUnhealthy, health: api.HostHealthHealthy, want: reconcile.DecisionReplace},
+		{state: api.HostUnhealthy, health: api.HostHealthUnhealthy, want: reconcile.DecisionReplace},
+		{state: api.HostTerminated, health: api.HostHealthUnknown, want: reconcile.DecisionNone},
+		{state: api.HostTerminated, health: api.HostHealthHealthy, want: reconcile.DecisionNone},
+		{state: api.HostTerminated, health: api.HostHealthUnhealthy, want: reconcile.DecisionNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.state)+"/"+string(tt.health), func(t *testing.T) {
+			got, reason := reconcile.DefaultPolicy{}.Decide(&api.Host{ID: "host-1", State: tt.state, Health: tt.health})
+			if got != tt.want {
+				t.Errorf("Decide() = %s (%s), want %s", got, reason, tt.want)
+			}
+			if reason == "" {
+				t.Errorf("Decide() gave no reason")
+			}
+		})
+	}
+}
+
+func TestReconcileDecision_Action(t *testing.T) {
+	tests := []struct {
+		decision reconcile.ReconcileDecision
+		want     execute.ActionType
+	}{
+		{decision: reconcile.DecisionDrain, want: execute.ActionDrainHost},
+		{decision: reconcile.DecisionReplace, want: execute.ActionReplaceHost},
+	}
+
+	for _, tt := range tests {
+		action := tt.decision.Action("host-1")
+		if action == nil || action.Type != tt.want || action.HostID != "host-1" {
+			t.Errorf("%s.Action() = %+v, want %s for host-1", tt.decision, action, tt.want)
+		}
+	}
+
+	if action := reconcile.DecisionNone.Action("host-1"); action != nil {
+		t.Errorf("DecisionNone.Action() = %+v, want nil", action)
+	}
+}
@@ -0,0 +1,70 @@
+package reconcile
+
+import (
+	"sync"
+
+	"github.com/nabutabu/crane-oss/pkg/reconcile/workqueue"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	reconcileDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "crane_reconcile_duration_seconds",
+		Help:    "Time taken to reconcile, by scope: a single host, or listing the catalog for a resync.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"scope"})
+	reconcileErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crane_reconcile_errors_total",
+		Help: "Failed reconciles, by scope: a single host, or listing the catalog for a resync.",
+	}, []string{"scope"})
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "crane_reconcile_queue_depth",
+		Help: "Hosts waiting to be reconciled.",
+	}, runningQueues.len)
+	reconcileFailingHosts = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "crane_reconcile_failing_hosts",
+		Help: "Hosts whose last reconcile failed.",
+	})
+	actionsEnqueued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crane_actions_enqueued_total",
+		Help: "Actions enqueued by the reconciler, by type.",
+	}, []string{"type"})
+)
+
+const (
+	scopeHost   = "host"
+	scopeResync = "resync"
+)
+
+// runningQueues holds the queues of the runners that are running, so that
+// the queue depth is read when scraped rather than going stale, and drops to
+// zero when the leader steps down.
+var runningQueues = &queueSet{queues: make(map[*workqueue.RateLimitingQueue]bool)}
+
+type queueSet struct {
+	mu     sync.Mutex
+	queues map[*workqueue.RateLimitingQueue]bool
+}
+
+func (s *queueSet) add(queue *workqueue.RateLimitingQueue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queues[queue] = true
+}
+
+func (s *queueSet) remove(queue *workqueue.RateLimitingQueue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.queues, queue)
+}
+
+func (s *queueSet) len() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int
+	for queue := range s.queues {
+		n += queue.Len()
+	}
+	return float64(n)
+}
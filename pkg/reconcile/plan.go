@@ -0,0 +1,64 @@
+package reconcile
+
+import (
+	"context"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/execute"
+	"github.com/nabutabu/crane-oss/pkg/api"
+)
+
+// PlannedAction is an action the reconciler would enqueue for a host, along
+// with what the policy saw and why it decided so.
+type PlannedAction struct {
+	HostID   string             `json:"host_id"`
+	State    api.HostState      `json:"state"`
+	Health   api.HostHealth     `json:"health"`
+	Decision ReconcileDecision  `json:"decision"`
+	Action   execute.ActionType `json:"action"`
+	Reason   string             `json:"reason"`
+	// BlockedBy explains which disruption budget holds the action back.
+	// Blocked actions are not enqueued.
+	BlockedBy string `json:"blocked_by,omitempty"`
+}
+
+// Plan is what a reconcile would do against the catalog as of CreatedAt.
+type Plan struct {
+	CreatedAt time.Time `json:"created_at"`
+	// Hosts is the number of hosts the policy was applied to, including
+	// those it decided to leave alone.
+	Hosts   int             `json:"hosts"`
+	Actions []PlannedAction `json:"actions"`
+}
+
+// Plan applies the policy to every host in the catalog and returns the
+// actions Reconcile would enqueue, without enqueueing them.
+func (r *DefaultHostReconciler) Plan(ctx context.Context) (*Plan, error) {
+	plan := &Plan{
+		CreatedAt: time.Now().UTC(),
+		Actions:   []PlannedAction{},
+	}
+
+	proposals, hosts, err := r.propose(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Hosts = hosts
+	for _, p := range proposals {
+		planned := PlannedAction{
+			HostID:   p.host.ID,
+			State:    p.host.State,
+			Health:   p.host.Health,
+			Decision: p.decision,
+			Action:   p.action.Type,
+			Reason:   p.reason,
+		}
+		if p.blocked != nil {
+			planned.BlockedBy = p.blocked.Error()
+		}
+		plan.Actions = append(plan.Actions, planned)
+	}
+
+	return plan, nil
+}
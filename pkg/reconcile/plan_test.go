@@ -0,0 +1,72 @@
+package reconcile_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nabutabu/crane-oss/internal/execute"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/pkg/api"
+	"github.com/nabutabu/crane-oss/pkg/reconcile"
+)
+
+func TestDefaultHostReconciler_Plan(t *testing.T) {
+	ctx := context.Background()
+	hosts := store.NewMemoryHostStore()
+	for _, h := range []*api.Host{
+		{ID: "healthy", State: api.HostReady, Health: api.HostHealthHealthy},
+		{ID: "sick", State: api.HostReady, Health: api.HostHealthUnhealthy},
+		{ID: "draining", State: api.HostDraining, Health: api.HostHealthHealthy},
+	} {
+		if err := hosts.Create(ctx, h); err != nil {
+			t.Fatalf("Create(%s) failed: %v", h.ID, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		queued map[string]bool
+		want   map[string]execute.ActionType
+	}{
+		{
+			name: "lists actions with their reason",
+			want: map[string]execute.ActionType{
+				"sick":     execute.ActionReplaceHost,
+				"draining": execute.ActionDrainHost,
+			},
+		},
+		{
+			name:   "leaves out hosts with an active action",
+			queued: map[string]bool{"draining": true},
+			want: map[string]execute.ActionType{
+				"sick": execute.ActionReplaceHost,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions := &fakeActions{queued: tt.queued}
+			plan, err := reconcile.NewDefaultHostReconciler(hosts, actions).Plan(ctx)
+			if err != nil {
+				t.Fatalf("Plan() failed: %v", err)
+			}
+
+			if len(actions.enqueued) != 0 {
+				t.Errorf("Plan() enqueued %+v", actions.enqueued)
+			}
+			if plan.Hosts != 3 {
+				t.Errorf("Plan() evaluated %d hosts, want 3", plan.Hosts)
+			}
+
+			if len(plan.Actions) != len(tt.want) {
+				t.Fatalf("Plan() = %+v, want actions for %v", plan.Actions, tt.want)
+			}
+			for _, a := range plan.Actions {
+				if tt.want[a.HostID] != a.Action || a.Reason == "" {
+					t.Errorf("planned %+v, want %s with a reason", a, tt.want[a.HostID])
+				}
+			}
+		})
+	}
+}
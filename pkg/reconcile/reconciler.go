@@ -2,34 +2,283 @@ package reconcile
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/nabutabu/crane-oss/internal/budget"
 	"github.com/nabutabu/crane-oss/internal/execute"
 	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
-	"log"
+	"github.com/nabutabu/crane-oss/internal/logging"
+	"github.com/nabutabu/crane-oss/internal/tracing"
+	"github.com/nabutabu/crane-oss/pkg/api"
+	"log/slog"
+	"maps"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/nabutabu/crane-oss/pkg/reconcile")
+
 type HostReconciler interface {
+	// Reconcile applies the policy to every host in the catalog.
 	Reconcile(ctx context.Context) error
+	// ReconcileHost applies the policy to a single host.
+	ReconcileHost(ctx context.Context, id string) error
+	// HostIDs returns the IDs of every host in the catalog.
+	HostIDs(ctx context.Context) ([]string, error)
 }
 
 type DefaultHostReconciler struct {
-	store   store.PostgresHostStore
+	store   store.HostStore
 	execute execute.ActionStore
+	policy  Policy
+	budgets *budget.Checker
+	logger  *slog.Logger
+
+	// mu serialises budget checks with the enqueues they allow, so that
+	// hosts reconciled in parallel cannot together exceed a budget. It also
+	// guards view.
+	mu   sync.Mutex
+	view *budgetView
+	// refreshMu makes workers that find view stale wait for one read of the
+	// catalog rather than each making their own.
+	refreshMu sync.Mutex
+}
+
+type Option func(*DefaultHostReconciler)
+
+// WithPolicy replaces DefaultPolicy as the policy deciding what to do about
+// each host.
+func WithPolicy(policy Policy) Option {
+	return func(r *DefaultHostReconciler) {
+		r.policy = policy
+	}
+}
+
+// WithBudgets holds back actions that would take more hosts out of service
+// than the disruption budgets allow.
+func WithBudgets(budgets *budget.Checker) Option {
+	return func(r *DefaultHostReconciler) {
+		r.budgets = budgets
+	}
 }
 
-func (r *DefaultHostReconciler) Reconcile(ctx context.Context) error {
-	hosts, err := r.store.ListHosts(ctx)
+// WithLogger replaces slog.Default as the logger decisions are logged to.
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *DefaultHostReconciler) {
+		r.logger = logger
+	}
+}
+
+func NewDefaultHostReconciler(store store.HostStore, actions execute.ActionStore, opts ...Option) *DefaultHostReconciler {
+	r := &DefaultHostReconciler{
+		store:   store,
+		execute: actions,
+		policy:  DefaultPolicy{},
+		logger:  slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *DefaultHostReconciler) Reconcile(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "Reconciler.Reconcile")
+	defer func() { tracing.End(span, err) }()
+
+	if r.budgets != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+	}
+
+	proposals, _, err := r.propose(ctx)
 	if err != nil {
 		return err
 	}
 
-	for _, host := range hosts {
-		action := Decide(host)
-		log.Printf("For host: %s, decision: %s", host, action)
-		err := r.execute.Enqueue(ctx, action)
-		if err != nil {
-			return err
+	// a host that cannot be reconciled does not hold up the rest
+	var errs []error
+	for _, p := range proposals {
+		if err := r.apply(ctx, p); err != nil {
+			errs = append(errs, fmt.Errorf("host %s: %w", p.host.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReconcileHost applies the policy to the host with the given id. Hosts that
+// no longer exist are ignored. With budgets, whether the host may be
+// disrupted depends on its peers; they are checked against a budgetView
+// rather than read for every host.
+func (r *DefaultHostReconciler) ReconcileHost(ctx context.Context, id string) error {
+	host, err := r.store.GetByID(ctx, id)
+	if errors.Is(err, api.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if r.budgets == nil {
+		p, ok := r.proposeHost(host, nil, make(map[string]bool))
+		if !ok {
+			return nil
 		}
+		return r.apply(ctx, p)
+	}
+
+	// most hosts need nothing, and those do not need their peers either
+	if decision, _ := r.policy.Decide(host); decision.Action(host.ID) == nil {
+		return nil
+	}
+	if _, err := r.refreshBudgetView(ctx, false); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.view.update(host)
+	p, ok := r.proposeHost(host, r.view.hosts, r.view.disrupted)
+	if !ok {
+		return nil
+	}
+	if p.blocked == nil {
+		r.view.markEnqueued(host.ID)
+	}
+	return r.apply(ctx, p)
+}
+
+// HostIDs returns the IDs of every host in the catalog. With budgets, the
+// read also refreshes the view budget checks are made against, so that a
+// resync reads the catalog once rather than once per host.
+func (r *DefaultHostReconciler) HostIDs(ctx context.Context) ([]string, error) {
+	var hosts []*api.Host
+	var err error
+	if r.budgets != nil {
+		hosts, err = r.refreshBudgetView(ctx, true)
+	} else {
+		hosts, err = store.ListAll(ctx, r.store, store.HostQuery{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		ids = append(ids, host.ID)
 	}
+	return ids, nil
+}
 
+// apply enqueues the action of a proposal unless a budget holds it back.
+func (r *DefaultHostReconciler) apply(ctx context.Context, p proposal) error {
+	logger := r.logger.With(logging.KeyHostID, p.host.ID, "decision", p.decision, "reason", p.reason)
+	span := trace.SpanFromContext(ctx)
+	if p.blocked != nil {
+		logger.InfoContext(ctx, "action held back", "error", p.blocked)
+		span.AddEvent("action held back", trace.WithAttributes(
+			tracing.KeyHostID.String(p.host.ID),
+			attribute.String("error", p.blocked.Error()),
+		))
+		return nil
+	}
+
+	// the worker that runs the action continues this request and trace
+	p.action.RequestID = logging.RequestID(ctx)
+	p.action.TraceParent = tracing.TraceParent(ctx)
+	record, err := r.execute.Enqueue(ctx, p.action)
+	if errors.Is(err, execute.ErrAlreadyQueued) {
+		logger.DebugContext(ctx, "action already queued", logging.KeyActionID, record.ID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	actionsEnqueued.WithLabelValues(string(p.action.Type)).Inc()
+	span.AddEvent("action enqueued", trace.WithAttributes(
+		tracing.KeyHostID.String(p.host.ID),
+		tracing.KeyActionID.Int(record.ID),
+		attribute.String("type", string(record.Type)),
+		attribute.String("reason", p.reason),
+	))
+	logger.InfoContext(ctx, "action enqueued", logging.KeyActionID, record.ID, "type", record.Type)
 	return nil
 }
+
+// proposal is what the policy wants done about a host.
+type proposal struct {
+	host     *api.Host
+	decision ReconcileDecision
+	reason   string
+	action   *execute.Action
+	// blocked is the budget error holding the action back, if any.
+	blocked error
+}
+
+// propose applies the policy to every host in the catalog and checks the
+// resulting actions against the disruption budgets. Hosts with an active
+// action count as disrupted, as do hosts given an action earlier in the same
+// pass. Hosts with an active action get no proposal, since Enqueue would not
+// queue another. It also returns the number of hosts evaluated.
+func (r *DefaultHostReconciler) propose(ctx context.Context) ([]proposal, int, error) {
+	hosts, err := store.ListAll(ctx, r.store, store.HostQuery{})
+	if err != nil {
+		return nil, 0, err
+	}
+	active, err := r.disrupted(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	disrupted := maps.Clone(active)
+	var proposals []proposal
+	for _, host := range hosts {
+		if p, ok := r.proposeHost(host, hosts, disrupted); ok && !active[host.ID] {
+			proposals = append(proposals, p)
+		}
+	}
+
+	return proposals, len(hosts), nil
+}
+
+// proposeHost applies the policy to host and, with budgets, checks the
+// action against hosts. A host given an action is added to disrupted. It
+// returns false if the policy wants nothing done.
+func (r *DefaultHostReconciler) proposeHost(host *api.Host, hosts []*api.Host, disrupted map[string]bool) (proposal, bool) {
+	decision, reason := r.policy.Decide(host)
+	action := decision.Action(host.ID)
+	if action == nil {
+		return proposal{}, false
+	}
+
+	p := proposal{
+		host:     host,
+		decision: decision,
+		reason:   reason,
+		action:   action,
+	}
+	if r.budgets != nil && !disrupted[host.ID] {
+		p.blocked = r.budgets.Check(host, hosts, disrupted)
+	}
+	if p.blocked == nil {
+		disrupted[host.ID] = true
+	}
+	return p, true
+}
+
+// disrupted returns the IDs of hosts with an active action.
+func (r *DefaultHostReconciler) disrupted(ctx context.Context) (map[string]bool, error) {
+	active, err := r.execute.Active(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	disrupted := make(map[string]bool, len(active))
+	for _, a := range active {
+		disrupted[a.HostID] = true
+	}
+	return disrupted, nil
+}
@@ -0,0 +1,344 @@
+package reconcile_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/nabutabu/crane-oss/internal/budget"
+	"github.com/nabutabu/crane-oss/internal/execute"
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/internal/logging"
+	"github.com/nabutabu/crane-oss/internal/tracing"
+	"github.com/nabutabu/crane-oss/pkg/api"
+	"github.com/nabutabu/crane-oss/pkg/reconcile"
+)
+
+var errEnqueue = errors.New("enqueue failed")
+
+// fakeActions records enqueued actions and reports hosts in queued as
+// already having an active action. Methods the reconciler does not use are
+// left to the nil embedded interface.
+type fakeActions struct {
+	execute.ActionStore
+	mu       sync.Mutex
+	queued   map[string]bool
+	failing  map[string]bool
+	enqueued []*execute.Action
+}
+
+func (f *fakeActions) Enqueue(ctx context.Context, action *execute.Action) (*execute.ActionRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failing[action.HostID] {
+		return nil, errEnqueue
+	}
+	if f.queued[action.HostID] {
+		return &execute.ActionRecord{HostID: action.HostID, Status: execute.ActionPending}, execute.ErrAlreadyQueued
+	}
+	f.enqueued = append(f.enqueued, action)
+	return &execute.ActionRecord{HostID: action.HostID, Type: action.Type, Status: execute.ActionPending}, nil
+}
+
+func (f *fakeActions) Active(ctx context.Context) ([]*execute.ActionRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var active []*execute.ActionRecord
+	for id := range f.queued {
+		active = append(active, &execute.ActionRecord{HostID: id, Status: execute.ActionRunning})
+	}
+	return active, nil
+}
+
+func TestDefaultHostReconciler_AlreadyQueued(t *testing.T) {
+	ctx := context.Background()
+	hosts := store.NewMemoryHostStore()
+	for _, id := range []string{"host-1", "host-2"} {
+		if err := hosts.Create(ctx, &api.Host{ID: id, State: api.HostReady, Health: api.HostHealthUnhealthy}); err != nil {
+			t.Fatalf("Create(%s) failed: %v", id, err)
+		}
+	}
+
+	actions := &fakeActions{queued: map[string]bool{"host-1": true}}
+	if err := reconcile.NewDefaultHostReconciler(hosts, actions).Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile() failed: %v", err)
+	}
+
+	if len(actions.enqueued) != 1 || actions.enqueued[0].HostID != "host-2" {
+		t.Errorf("enqueued %+v, want a single action for host-2", actions.enqueued)
+	}
+}
+
+func TestDefaultHostReconciler_RequestID(t *testing.T) {
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	ctx = tracing.WithTraceParent(ctx, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	hosts := store.NewMemoryHostStore()
+	if err := hosts.Create(ctx, &api.Host{ID: "host-1", State: api.HostReady, Health: api.HostHealthUnhealthy}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	actions := &fakeActions{}
+	if err := reconcile.NewDefaultHostReconciler(hosts, actions).ReconcileHost(ctx, "host-1"); err != nil {
+		t.Fatalf("ReconcileHost() failed: %v", err)
+	}
+
+	if len(actions.enqueued) != 1 || actions.enqueued[0].RequestID != "req-1" {
+		t.Fatalf("enqueued %+v, want a single action carrying req-1", actions.enqueued)
+	}
+	if got := actions.enqueued[0].TraceParent; got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("action carries traceparent %q, want that of the reconcile", got)
+	}
+}
+
+func TestDefaultHostReconciler_IsolatesErrors(t *testing.T) {
+	ctx := context.Background()
+	hosts := store.NewMemoryHostStore()
+	for _, id := range []string{"host-1", "host-2", "host-3"} {
+		if err := hosts.Create(ctx, &api.Host{ID: id, State: api.HostReady, Health: api.HostHealthUnhealthy}); err != nil {
+			t.Fatalf("Create(%s) failed: %v", id, err)
+		}
+	}
+
+	actions := &fakeActions{failing: map[string]bool{"host-1": true}}
+	err := reconcile.NewDefaultHostReconciler(hosts, actions).Reconcile(ctx)
+	if !errors.Is(err, errEnqueue) {
+		t.Fatalf("Reconcile() error = %v, want %v", err, errEnqueue)
+	}
+
+	if len(actions.enqueued) != 2 {
+		t.Errorf("enqueued %+v, want actions for host-2 and host-3", actions.enqueued)
+	}
+}
+
+func TestDefaultHostReconciler_Policy(t *testing.T) {
+	ctx := context.Background()
+	hosts := store.NewMemoryHostStore()
+	for _, h := range []*api.Host{
+		{ID: "healthy", State: api.HostReady, Health: api.HostHealthHealthy},
+		{ID: "draining", State: api.HostDraining, Health: api.HostHealthHealthy},
+		{ID: "terminated", State: api.HostTerminated},
+	} {
+		if err := hosts.Create(ctx, h); err != nil {
+			t.Fatalf("Create(%s) failed: %v", h.ID, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts []reconcile.Option
+		want map[string]execute.ActionType
+	}{
+		{
+			name: "default policy leaves healthy hosts alone",
+			want: map[string]execute.ActionType{"draining": execute.ActionDrainHost},
+		},
+		{
+			name: "custom policy",
+			opts: []reconcile.Option{reconcile.WithPolicy(reconcile.PolicyFunc(func(host *api.Host) (reconcile.ReconcileDecision, string) {
+				if host.ID == "healthy" {
+					return reconcile.DecisionReplace, "replace everything healthy"
+				}
+				return reconcile.DecisionNone, "not healthy"
+			}))},
+			want: map[string]execute.ActionType{"healthy": execute.ActionReplaceHost},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions := &fakeActions{}
+			if err := reconcile.NewDefaultHostReconciler(hosts, actions, tt.opts...).Reconcile(ctx); err != nil {
+				t.Fatalf("Reconcile() failed: %v", err)
+			}
+
+			got := make(map[string]execute.ActionType)
+			for _, action := range actions.enqueued {
+				got[action.HostID] = action.Type
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("enqueued %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultHostReconciler_Budgets(t *testing.T) {
+	ctx := context.Background()
+	hosts := store.NewMemoryHostStore()
+	for _, h := range []*api.Host{
+		{ID: "a1", Zone: "a", State: api.HostReady, Health: api.HostHealthUnhealthy},
+		{ID: "a2", Zone: "a", State: api.HostReady, Health: api.HostHealthUnhealthy},
+		{ID: "a3", Zone: "a", State: api.HostReady, Health: api.HostHealthHealthy},
+		{ID: "b1", Zone: "b", State: api.HostReady, Health: api.HostHealthUnhealthy},
+		{ID: "b2", Zone: "b", State: api.HostReady, Health: api.HostHealthUnhealthy},
+		{ID: "b3", Zone: "b", State: api.HostReady, Health: api.HostHealthHealthy},
+	} {
+		if err := hosts.Create(ctx, h); err != nil {
+			t.Fatalf("Create(%s) failed: %v", h.ID, err)
+		}
+	}
+
+	budgets := budget.NewChecker([]budget.Budget{
+		{Name: "per-zone", Zone: budget.Each, MaxUnavailable: budget.Limit{Count: 1}},
+	})
+	// b1 already has an action running, which uses up zone b's budget
+	actions := &fakeActions{queued: map[string]bool{"b1": true}}
+	reconciler := reconcile.NewDefaultHostReconciler(hosts, actions, reconcile.WithBudgets(budgets))
+
+	plan, err := reconciler.Plan(ctx)
+	if err != nil {
+		t.Fatalf("Plan() failed: %v", err)
+	}
+	blocked := make(map[string]bool)
+	for _, a := range plan.Actions {
+		if a.BlockedBy != "" {
+			blocked[a.HostID] = true
+		}
+	}
+	if want := map[string]bool{"a2": true, "b2": true}; !maps.Equal(blocked, want) {
+		t.Errorf("blocked = %v, want %v", blocked, want)
+	}
+
+	if err := reconciler.Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile() failed: %v", err)
+	}
+	if len(actions.enqueued) != 1 || actions.enqueued[0].HostID != "a1" {
+		t.Errorf("enqueued %+v, want a single action for a1", actions.enqueued)
+	}
+}
+
+func TestDefaultHostReconciler_ReconcileHost(t *testing.T) {
+	ctx := context.Background()
+	hosts := store.NewMemoryHostStore()
+	for _, h := range []*api.Host{
+		{ID: "a1", Zone: "a", State: api.HostReady, Health: api.HostHealthUnhealthy},
+		{ID: "a2", Zone: "a", State: api.HostReady, Health: api.HostHealthUnhealthy},
+		{ID: "a3", Zone: "a", State: api.HostReady, Health: api.HostHealthHealthy},
+		{ID: "b1", Zone: "b", State: api.HostReady, Health: api.HostHealthUnhealthy},
+		{ID: "b2", Zone: "b", State: api.HostReady, Health: api.HostHealthHealthy},
+	} {
+		if err := hosts.Create(ctx, h); err != nil {
+			t.Fatalf("Create(%s) failed: %v", h.ID, err)
+		}
+	}
+
+	budgets := budget.NewChecker([]budget.Budget{
+		{Name: "per-zone", Zone: budget.Each, MaxUnavailable: budget.Limit{Count: 1}},
+	})
+
+	tests := []struct {
+		name   string
+		id     string
+		queued map[string]bool
+		want   []string
+	}{
+		{name: "enqueues for the host", id: "a2", want: []string{"a2"}},
+		{name: "leaves other hosts alone", id: "a3"},
+		{name: "missing host is ignored", id: "gone"},
+		{name: "held back by budget", id: "a2", queued: map[string]bool{"a1": true}},
+		{name: "budget of other zone does not apply", id: "b1", queued: map[string]bool{"a1": true}, want: []string{"b1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions := &fakeActions{queued: tt.queued}
+			reconciler := reconcile.NewDefaultHostReconciler(hosts, actions, reconcile.WithBudgets(budgets))
+			if err := reconciler.ReconcileHost(ctx, tt.id); err != nil {
+				t.Fatalf("ReconcileHost(%s) failed: %v", tt.id, err)
+			}
+
+			var got []string
+			for _, action := range actions.enqueued {
+				got = append(got, action.HostID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("enqueued %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// countingHosts counts the catalog pages listed through it.
+type countingHosts struct {
+	store.HostStore
+	mu    sync.Mutex
+	lists int
+}
+
+func (c *countingHosts) List(ctx context.Context, q store.HostQuery) (*store.HostPage, error) {
+	c.mu.Lock()
+	c.lists++
+	c.mu.Unlock()
+	return c.HostStore.List(ctx, q)
+}
+
+func TestDefaultHostReconciler_ResyncReadsCatalogOnce(t *testing.T) {
+	ctx := context.Background()
+	memory := store.NewMemoryHostStore()
+	for _, id := range []string{"a1", "a2", "a3", "a4"} {
+		if err := memory.Create(ctx, &api.Host{ID: id, Zone: "a", State: api.HostReady, Health: api.HostHealthUnhealthy}); err != nil {
+			t.Fatalf("Create(%s) failed: %v", id, err)
+		}
+	}
+	hosts := &countingHosts{HostStore: memory}
+
+	budgets := budget.NewChecker([]budget.Budget{
+		{Name: "per-zone", Zone: budget.Each, MaxUnavailable: budget.Limit{Count: 1}},
+	})
+	actions := &fakeActions{}
+	reconciler := reconcile.NewDefaultHostReconciler(hosts, actions, reconcile.WithBudgets(budgets))
+
+	ids, err := reconciler.HostIDs(ctx)
+	if err != nil {
+		t.Fatalf("HostIDs() failed: %v", err)
+	}
+	for _, id := range ids {
+		if err := reconciler.ReconcileHost(ctx, id); err != nil {
+			t.Fatalf("ReconcileHost(%s) failed: %v", id, err)
+		}
+	}
+
+	if hosts.lists != 1 {
+		t.Errorf("catalog listed %d times, want 1", hosts.lists)
+	}
+	if len(actions.enqueued) != 1 {
+		t.Errorf("enqueued %d actions, want 1 within the budget", len(actions.enqueued))
+	}
+}
+
+func TestDefaultHostReconciler_ReconcileHostParallel(t *testing.T) {
+	ctx := context.Background()
+	hosts := store.NewMemoryHostStore()
+	var ids []string
+	for i := range 20 {
+		id := fmt.Sprintf("a%d", i)
+		if err := hosts.Create(ctx, &api.Host{ID: id, Zone: "a", State: api.HostReady, Health: api.HostHealthUnhealthy}); err != nil {
+			t.Fatalf("Create(%s) failed: %v", id, err)
+		}
+		ids = append(ids, id)
+	}
+
+	budgets := budget.NewChecker([]budget.Budget{
+		{Name: "per-zone", Zone: budget.Each, MaxUnavailable: budget.Limit{Count: 1}},
+	})
+	actions := &fakeActions{}
+	reconciler := reconcile.NewDefaultHostReconciler(hosts, actions, reconcile.WithBudgets(budgets))
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Go(func() {
+			if err := reconciler.ReconcileHost(ctx, id); err != nil {
+				t.Errorf("ReconcileHost(%s) failed: %v", id, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if len(actions.enqueued) != 1 {
+		t.Errorf("enqueued %d actions, want 1 within the budget", len(actions.enqueued))
+	}
+}
@@ -1,28 +1,400 @@
 package reconcile
 
 import (
+	"cmp"
 	"context"
-	"log"
+	"encoding/json"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
 	"time"
+
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/internal/logging"
+	"github.com/nabutabu/crane-oss/internal/tracing"
+	"github.com/nabutabu/crane-oss/pkg/reconcile/workqueue"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// resyncKey is the queue key of a full pass over the catalog. Host IDs are
+// never empty, so it cannot collide with one.
+const resyncKey = ""
+
+// listenRetryDelay is how long the runner waits before listening again after
+// its Source failed.
+const listenRetryDelay = 5 * time.Second
+
+// resyncJitter stretches each resync interval by up to this fraction, so
+// that restarted leaders do not all resync in step.
+const resyncJitter = 0.1
+
+// DefaultRunnerWorkers is the number of hosts reconciled in parallel unless
+// WithWorkers says otherwise.
+const DefaultRunnerWorkers = 4
+
+// Source reports hosts that changed. Listen calls changed for every change
+// until ctx is done, and resync whenever changes may have been missed.
+type Source interface {
+	Listen(ctx context.Context, changed func(store.HostChange), resync func()) error
+}
+
+// Runner drives a HostReconciler through a work queue keyed by host ID.
+// Hosts reported by its Source are queued as they change; every host is
+// queued when the runner starts and then about every interval, to catch
+// anything the Source missed. Several workers reconcile queued hosts in
+// parallel, and a host that fails is retried with exponential backoff
+// without holding up the others.
+//
+// Every reconcile runs with a request ID: that of the change that queued the
+// host, or one shared by all hosts of a resync. It ends up on the actions
+// the reconcile enqueues. Likewise, the reconcile of a changed host is traced
+// as part of the trace that changed it, while hosts queued by a resync start
+// traces of their own that link to the resync.
 type Runner struct {
 	reconciler HostReconciler
 	interval   time.Duration
+	source     Source
+	workers    int
+	limiter    workqueue.RateLimiter
+	logger     *slog.Logger
+
+	mu         sync.Mutex
+	causes     map[string]cause
+	queue      *workqueue.RateLimitingQueue
+	reconciles int64
+	errors     int64
+	failing    map[string]*HostFailure
+}
+
+// RunnerStats describes how reconciliation is going on this replica. Only
+// the leader reconciles, so other replicas report nothing.
+type RunnerStats struct {
+	Reconciles int64 `json:"reconciles"`
+	Errors     int64 `json:"errors"`
+	QueueDepth int   `json:"queue_depth"`
+	// Failing lists the hosts whose last reconcile failed, by ID.
+	Failing []HostFailure `json:"failing"`
+}
+
+// cause is what queued a host: a change, or a resync.
+type cause struct {
+	requestID string
+	// span made the change, or listed the host if resync is set.
+	span   trace.SpanContext
+	resync bool
+}
+
+// HostFailure is a host that has failed to reconcile since it last
+// succeeded.
+type HostFailure struct {
+	HostID    string    `json:"host_id"`
+	Failures  int       `json:"failures"`
+	LastError string    `json:"last_error"`
+	Since     time.Time `json:"since"`
+}
+
+type RunnerOption func(*Runner)
+
+// WithSource reconciles hosts as soon as source reports them changed.
+func WithSource(source Source) RunnerOption {
+	return func(r *Runner) {
+		r.source = source
+	}
+}
+
+// WithWorkers sets how many hosts are reconciled in parallel.
+func WithWorkers(n int) RunnerOption {
+	return func(r *Runner) {
+		r.workers = n
+	}
+}
+
+// WithRunnerLogger replaces slog.Default as the logger reconcile errors are
+// logged to.
+func WithRunnerLogger(logger *slog.Logger) RunnerOption {
+	return func(r *Runner) {
+		r.logger = logger
+	}
+}
+
+// WithRateLimiter replaces workqueue.DefaultRateLimiter as the limiter
+// deciding when failed hosts are retried.
+func WithRateLimiter(limiter workqueue.RateLimiter) RunnerOption {
+	return func(r *Runner) {
+		r.limiter = limiter
+	}
+}
+
+func NewRunner(reconciler HostReconciler, interval time.Duration, opts ...RunnerOption) *Runner {
+	r := &Runner{
+		reconciler: reconciler,
+		interval:   interval,
+		workers:    DefaultRunnerWorkers,
+		limiter:    workqueue.DefaultRateLimiter(),
+		logger:     slog.Default(),
+		causes:     make(map[string]cause),
+		failing:    make(map[string]*HostFailure),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.workers <= 0 {
+		r.workers = 1
+	}
+	return r
 }
 
 func (r *Runner) Run(ctx context.Context) {
-	ticker := time.NewTicker(r.interval)
-	defer ticker.Stop()
+	queue := workqueue.NewRateLimiting(r.limiter)
+	r.mu.Lock()
+	r.queue = queue
+	r.mu.Unlock()
+	runningQueues.add(queue)
+	defer runningQueues.remove(queue)
+	defer r.stepDown()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	wg.Go(func() {
+		r.resync(ctx, queue)
+	})
+	if r.source != nil {
+		wg.Go(func() {
+			r.listen(ctx, queue)
+		})
+	}
+	for range r.workers {
+		wg.Go(func() {
+			r.work(ctx, queue)
+		})
+	}
+
+	queue.Add(resyncKey)
+	<-ctx.Done()
+	queue.ShutDown()
+}
+
+func (r *Runner) work(ctx context.Context, queue *workqueue.RateLimitingQueue) {
+	for {
+		key, shutdown := queue.Get()
+		if shutdown {
+			return
+		}
+		r.process(ctx, queue, key)
+		queue.Done(key)
+	}
+}
+
+func (r *Runner) process(ctx context.Context, queue *workqueue.RateLimitingQueue, key string) {
+	if key == resyncKey {
+		r.processResync(ctx, queue)
+		return
+	}
+
+	c := r.takeCause(key)
+	if c.requestID == "" {
+		c.requestID = logging.NewRequestID()
+	}
+	ctx = logging.WithRequestID(ctx, c.requestID)
+
+	opts := []trace.SpanStartOption{
+		trace.WithAttributes(tracing.KeyHostID.String(key), tracing.KeyRequestID.String(c.requestID)),
+	}
+	if c.resync {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: c.span}))
+	} else if c.span.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, c.span)
+	}
+	ctx, span := tracer.Start(ctx, "Runner.reconcileHost", opts...)
 
+	timer := prometheus.NewTimer(reconcileDuration.WithLabelValues(scopeHost))
+	err := r.reconciler.ReconcileHost(ctx, key)
+	timer.ObserveDuration()
+	tracing.End(span, err)
+	if ctx.Err() != nil {
+		// stepping down is not the host's fault
+		return
+	}
+	r.record(key, err)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "reconcile host",
+			logging.KeyHostID, key,
+			"attempt", queue.NumRequeues(key)+1,
+			"error", err,
+		)
+		// the retry still belongs to the same request
+		r.setCause(key, c, false)
+		queue.AddRateLimited(key)
+		return
+	}
+	queue.Forget(key)
+}
+
+// processResync queues every host, under one request ID and span.
+func (r *Runner) processResync(ctx context.Context, queue *workqueue.RateLimitingQueue) {
+	requestID := logging.NewRequestID()
+	ctx = logging.WithRequestID(ctx, requestID)
+	ctx, span := tracer.Start(ctx, "Runner.resync",
+		trace.WithNewRoot(),
+		trace.WithAttributes(tracing.KeyRequestID.String(requestID)),
+	)
+
+	timer := prometheus.NewTimer(reconcileDuration.WithLabelValues(scopeResync))
+	ids, err := r.reconciler.HostIDs(ctx)
+	timer.ObserveDuration()
+	tracing.End(span, err)
+	if err != nil {
+		if ctx.Err() == nil {
+			reconcileErrors.WithLabelValues(scopeResync).Inc()
+			r.logger.ErrorContext(ctx, "list hosts for resync", "error", err)
+			queue.AddRateLimited(resyncKey)
+		}
+		return
+	}
+	queue.Forget(resyncKey)
+
+	r.logger.DebugContext(ctx, "resync", "hosts", len(ids))
+	c := cause{requestID: requestID, span: span.SpanContext(), resync: true}
+	for _, id := range ids {
+		r.setCause(id, c, false)
+		queue.Add(id)
+	}
+}
+
+// setCause remembers c as the cause of the next reconcile of host id. Unless
+// overwrite is set, a cause already remembered is kept.
+func (r *Runner) setCause(id string, c cause, overwrite bool) {
+	if c.requestID == "" && !c.span.IsValid() {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.causes[id]; ok && !overwrite {
+		return
+	}
+	r.causes[id] = c
+}
+
+func (r *Runner) takeCause(id string) cause {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.causes[id]
+	delete(r.causes, id)
+	return c
+}
+
+func (r *Runner) record(id string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reconciles++
+	defer func() {
+		reconcileFailingHosts.Set(float64(len(r.failing)))
+	}()
+	if err == nil {
+		delete(r.failing, id)
+		return
+	}
+
+	r.errors++
+	reconcileErrors.WithLabelValues(scopeHost).Inc()
+	f, ok := r.failing[id]
+	if !ok {
+		f = &HostFailure{HostID: id, Since: time.Now().UTC()}
+		r.failing[id] = f
+	}
+	f.Failures++
+	f.LastError = err.Error()
+}
+
+// stepDown forgets the failing hosts once the runner stops, since another
+// replica is now reconciling them.
+func (r *Runner) stepDown() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.failing)
+	reconcileFailingHosts.Set(0)
+}
+
+// Stats reports how reconciliation is going on this replica.
+func (r *Runner) Stats() RunnerStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := RunnerStats{
+		Reconciles: r.reconciles,
+		Errors:     r.errors,
+		Failing:    make([]HostFailure, 0, len(r.failing)),
+	}
+	if r.queue != nil {
+		stats.QueueDepth = r.queue.Len()
+	}
+	for _, f := range r.failing {
+		stats.Failing = append(stats.Failing, *f)
+	}
+	slices.SortFunc(stats.Failing, func(a, b HostFailure) int {
+		return cmp.Compare(a.HostID, b.HostID)
+	})
+	return stats
+}
+
+// ServeHTTP reports the Stats of this replica.
+func (r *Runner) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.Stats())
+}
+
+func (r *Runner) resync(ctx context.Context, queue *workqueue.RateLimitingQueue) {
 	for {
+		timer := time.NewTimer(jitter(r.interval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			queue.Add(resyncKey)
+		}
+	}
+}
+
+// jitter returns d stretched by a random fraction of up to resyncJitter.
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration(rand.Float64()*resyncJitter*float64(d))
+}
+
+func (r *Runner) listen(ctx context.Context, queue *workqueue.RateLimitingQueue) {
+	changed := func(change store.HostChange) {
+		// the latest change is the one the reconcile will act on
+		ctx := tracing.WithTraceParent(context.Background(), change.TraceParent)
+		r.setCause(change.HostID, cause{
+			requestID: change.RequestID,
+			span:      trace.SpanContextFromContext(ctx),
+		}, true)
+		queue.Add(change.HostID)
+	}
+	resync := func() {
+		queue.Add(resyncKey)
+	}
+
+	for {
+		err := r.source.Listen(ctx, changed, resync)
+		if ctx.Err() != nil {
+			return
+		}
+		r.logger.WarnContext(ctx, "host change listener stopped", "error", err)
+
+		// changes made while nobody listened are only seen by a full pass
+		resync()
+
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			if err := r.reconciler.Reconcile(ctx); err != nil {
-				log.Printf("reconcile error: %v", err)
-			}
+		case <-time.After(listenRetryDelay):
 		}
 	}
 }
@@ -0,0 +1,236 @@
+package reconcile_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nabutabu/crane-oss/internal/hostcatalog/store"
+	"github.com/nabutabu/crane-oss/internal/logging"
+	"github.com/nabutabu/crane-oss/pkg/reconcile"
+	"github.com/nabutabu/crane-oss/pkg/reconcile/workqueue"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errReconcile = errors.New("reconcile failed")
+
+// fakeReconciler reports ids as the catalog and fails the hosts in failures
+// the given number of times. Every reconcile is reported on done.
+type fakeReconciler struct {
+	ids []string
+
+	mu         sync.Mutex
+	failures   map[string]int
+	attempts   map[string]int
+	requestIDs map[string]string
+	traceIDs   map[string]trace.TraceID
+	done       chan string
+}
+
+func newFakeReconciler(ids ...string) *fakeReconciler {
+	return &fakeReconciler{
+		ids:        ids,
+		failures:   make(map[string]int),
+		attempts:   make(map[string]int),
+		requestIDs: make(map[string]string),
+		traceIDs:   make(map[string]trace.TraceID),
+		done:       make(chan string, 100),
+	}
+}
+
+func (f *fakeReconciler) Reconcile(ctx context.Context) error {
+	return nil
+}
+
+func (f *fakeReconciler) ReconcileHost(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.attempts[id]++
+	f.requestIDs[id] = logging.RequestID(ctx)
+	f.traceIDs[id] = trace.SpanContextFromContext(ctx).TraceID()
+	f.done <- id
+	if f.attempts[id] <= f.failures[id] {
+		return errReconcile
+	}
+	return nil
+}
+
+func (f *fakeReconciler) HostIDs(ctx context.Context) ([]string, error) {
+	return f.ids, nil
+}
+
+// wait returns once id has been reconciled n times in total.
+func (f *fakeReconciler) wait(t *testing.T, id string, n int) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		f.mu.Lock()
+		got := f.attempts[id]
+		f.mu.Unlock()
+		if got >= n {
+			return
+		}
+
+		select {
+		case <-f.done:
+		case <-timeout:
+			t.Fatalf("%s reconciled %d times, want %d", id, got, n)
+		}
+	}
+}
+
+// fakeSource reports the changes sent on changes.
+type fakeSource struct {
+	changes chan store.HostChange
+}
+
+func (f *fakeSource) Listen(ctx context.Context, changed func(store.HostChange), resync func()) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case c := <-f.changes:
+			changed(c)
+		}
+	}
+}
+
+// waitStats returns the stats of runner once ok accepts them.
+func waitStats(t *testing.T, runner *reconcile.Runner, ok func(reconcile.RunnerStats) bool) reconcile.RunnerStats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := runner.Stats()
+		if ok(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stats = %+v", stats)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// startRunner runs runner until the test ends.
+func startRunner(t *testing.T, runner *reconcile.Runner) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+}
+
+func TestRunner_ReconcilesAllHostsOnStart(t *testing.T) {
+	reconciler := newFakeReconciler("host-1", "host-2", "host-3")
+	startRunner(t, reconcile.NewRunner(reconciler, time.Hour))
+
+	for _, id := range reconciler.ids {
+		reconciler.wait(t, id, 1)
+	}
+
+	// one pass, one request
+	reconciler.mu.Lock()
+	defer reconciler.mu.Unlock()
+	requestID := reconciler.requestIDs["host-1"]
+	for id, got := range reconciler.requestIDs {
+		if got == "" || got != requestID {
+			t.Errorf("request ID of %s = %q, want %q shared by the pass", id, got, requestID)
+		}
+	}
+}
+
+func TestRunner_ReconcilesChangedHosts(t *testing.T) {
+	reconciler := newFakeReconciler()
+	source := &fakeSource{changes: make(chan store.HostChange)}
+	startRunner(t, reconcile.NewRunner(reconciler, time.Hour, reconcile.WithSource(source)))
+
+	for _, c := range []store.HostChange{
+		{HostID: "host-1", RequestID: "req-1", TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{HostID: "host-2"},
+	} {
+		source.changes <- c
+		reconciler.wait(t, c.HostID, 1)
+	}
+
+	reconciler.mu.Lock()
+	defer reconciler.mu.Unlock()
+	if got := reconciler.requestIDs["host-1"]; got != "req-1" {
+		t.Errorf("request ID of host-1 = %q, want req-1 from the change", got)
+	}
+	if got := reconciler.requestIDs["host-2"]; got == "" {
+		t.Error("host-2 was reconciled without a request ID")
+	}
+	if got := reconciler.traceIDs["host-1"].String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace of host-1 = %s, want the trace of the change", got)
+	}
+}
+
+func TestRunner_RetriesFailingHost(t *testing.T) {
+	reconciler := newFakeReconciler("bad", "good")
+	reconciler.failures["bad"] = 2
+
+	runner := reconcile.NewRunner(reconciler, time.Hour,
+		reconcile.WithRateLimiter(workqueue.NewItemExponentialRateLimiter(time.Millisecond, 10*time.Millisecond)))
+	startRunner(t, runner)
+
+	stats := waitStats(t, runner, func(stats reconcile.RunnerStats) bool {
+		return stats.Reconciles == 4
+	})
+	if stats.Errors != 2 {
+		t.Errorf("errors = %d, want 2", stats.Errors)
+	}
+	if len(stats.Failing) != 0 {
+		t.Errorf("failing = %+v, want none after bad recovered", stats.Failing)
+	}
+}
+
+func TestRunner_ReportsFailingHosts(t *testing.T) {
+	reconciler := newFakeReconciler("bad", "good")
+	reconciler.failures["bad"] = 1
+
+	runner := reconcile.NewRunner(reconciler, time.Hour,
+		reconcile.WithRateLimiter(workqueue.NewItemExponentialRateLimiter(time.Hour, time.Hour)))
+	startRunner(t, runner)
+
+	stats := waitStats(t, runner, func(stats reconcile.RunnerStats) bool {
+		return stats.Reconciles == 2
+	})
+	if len(stats.Failing) != 1 {
+		t.Fatalf("failing = %+v, want bad", stats.Failing)
+	}
+	if f := stats.Failing[0]; f.HostID != "bad" || f.Failures != 1 || f.LastError != errReconcile.Error() {
+		t.Errorf("failing = %+v, want bad failed once with %q", f, errReconcile)
+	}
+}
+
+func TestRunner_ForgetsFailingHostsOnStepDown(t *testing.T) {
+	reconciler := newFakeReconciler("bad")
+	reconciler.failures["bad"] = 1
+
+	runner := reconcile.NewRunner(reconciler, time.Hour,
+		reconcile.WithRateLimiter(workqueue.NewItemExponentialRateLimiter(time.Hour, time.Hour)))
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(stopped)
+	}()
+
+	waitStats(t, runner, func(stats reconcile.RunnerStats) bool {
+		return len(stats.Failing) == 1
+	})
+	cancel()
+	<-stopped
+
+	if stats := runner.Stats(); len(stats.Failing) != 0 {
+		t.Errorf("failing = %+v after stepping down, want none", stats.Failing)
+	}
+}
@@ -0,0 +1,95 @@
+// Package workqueue is a deduplicating queue of keys for controller loops,
+// modelled on client-go's workqueue. A key is held at most once no matter how
+// often it is added, and never handed to two consumers at the same time: a
+// key added while it is being processed is queued again once it is Done.
+package workqueue
+
+import "sync"
+
+type Queue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	queue []string
+	// dirty holds keys waiting to be processed, processing those handed out
+	// by Get and not yet Done.
+	dirty      map[string]bool
+	processing map[string]bool
+	shutdown   bool
+}
+
+func New() *Queue {
+	q := &Queue{
+		dirty:      make(map[string]bool),
+		processing: make(map[string]bool),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Add queues key unless it is already waiting.
+func (q *Queue) Add(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.shutdown || q.dirty[key] {
+		return
+	}
+	q.dirty[key] = true
+
+	// a key being processed is queued again by Done
+	if q.processing[key] {
+		return
+	}
+	q.queue = append(q.queue, key)
+	q.cond.Signal()
+}
+
+// Get blocks until a key is available and returns it. It returns shutdown
+// true once the queue has been shut down.
+func (q *Queue) Get() (key string, shutdown bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.queue) == 0 && !q.shutdown {
+		q.cond.Wait()
+	}
+	if q.shutdown {
+		return "", true
+	}
+
+	key, q.queue = q.queue[0], q.queue[1:]
+	delete(q.dirty, key)
+	q.processing[key] = true
+	return key, false
+}
+
+// Done marks key as processed. It must be called once for every key
+// returned by Get.
+func (q *Queue) Done(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.processing, key)
+	if q.dirty[key] && !q.shutdown {
+		q.queue = append(q.queue, key)
+		q.cond.Signal()
+	}
+}
+
+// Len returns the number of keys waiting to be processed.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queue)
+}
+
+// ShutDown makes Get return shutdown to every consumer and ignores further
+// Adds.
+func (q *Queue) ShutDown() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.shutdown = true
+	q.cond.Broadcast()
+}
@@ -0,0 +1,122 @@
+package workqueue_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nabutabu/crane-oss/pkg/reconcile/workqueue"
+)
+
+func TestQueue_Deduplicates(t *testing.T) {
+	q := workqueue.New()
+	q.Add("a")
+	q.Add("b")
+	q.Add("a")
+
+	if got := q.Len(); got != 2 {
+		t.Fatalf("Len() = %d, want 2", got)
+	}
+
+	for _, want := range []string{"a", "b"} {
+		key, shutdown := q.Get()
+		if shutdown || key != want {
+			t.Fatalf("Get() = %q, %v, want %q, false", key, shutdown, want)
+		}
+		q.Done(key)
+	}
+}
+
+func TestQueue_AddWhileProcessing(t *testing.T) {
+	q := workqueue.New()
+	q.Add("a")
+
+	key, _ := q.Get()
+	// not handed out again until Done
+	q.Add("a")
+	q.Add("a")
+	if got := q.Len(); got != 0 {
+		t.Fatalf("Len() while processing = %d, want 0", got)
+	}
+
+	q.Done(key)
+	if got := q.Len(); got != 1 {
+		t.Fatalf("Len() after Done = %d, want 1", got)
+	}
+	if key, _ := q.Get(); key != "a" {
+		t.Errorf("Get() = %q, want a", key)
+	}
+}
+
+func TestQueue_ShutDown(t *testing.T) {
+	q := workqueue.New()
+
+	result := make(chan bool)
+	go func() {
+		_, shutdown := q.Get()
+		result <- shutdown
+	}()
+
+	q.ShutDown()
+	if !<-result {
+		t.Error("Get() did not report shutdown")
+	}
+
+	q.Add("a")
+	if got := q.Len(); got != 0 {
+		t.Errorf("Len() after ShutDown = %d, want 0", got)
+	}
+}
+
+func TestItemExponentialRateLimiter(t *testing.T) {
+	l := workqueue.NewItemExponentialRateLimiter(time.Second, 5*time.Second)
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if got := l.When("a"); got != want {
+			t.Errorf("When() = %s, want %s", got, want)
+		}
+	}
+	if got := l.When("b"); got != time.Second {
+		t.Errorf("When() of another key = %s, want 1s", got)
+	}
+	if got := l.NumRequeues("a"); got != 5 {
+		t.Errorf("NumRequeues() = %d, want 5", got)
+	}
+
+	l.Forget("a")
+	if got := l.When("a"); got != time.Second {
+		t.Errorf("When() after Forget = %s, want 1s", got)
+	}
+}
+
+func TestBucketRateLimiter(t *testing.T) {
+	l := workqueue.NewBucketRateLimiter(1, 2)
+
+	for i := range 2 {
+		if got := l.When("a"); got != 0 {
+			t.Errorf("When() #%d within burst = %s, want 0", i, got)
+		}
+	}
+	if got := l.When("b"); got < 900*time.Millisecond || got > time.Second {
+		t.Errorf("When() past burst = %s, want about 1s", got)
+	}
+}
+
+func TestRateLimitingQueue_AddAfter(t *testing.T) {
+	q := workqueue.NewRateLimiting(workqueue.DefaultRateLimiter())
+	defer q.ShutDown()
+
+	q.AddAfter("a", time.Hour)
+	q.AddAfter("a", 10*time.Millisecond)
+	if got := q.Len(); got != 0 {
+		t.Fatalf("Len() before delay = %d, want 0", got)
+	}
+
+	key, shutdown := q.Get()
+	if shutdown || key != "a" {
+		t.Fatalf("Get() = %q, %v, want a, false", key, shutdown)
+	}
+	q.Done(key)
+	if got := q.Len(); got != 0 {
+		t.Errorf("Len() = %d, want 0: the earlier delay replaces the later one", got)
+	}
+}
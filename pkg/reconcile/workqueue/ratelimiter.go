@@ -0,0 +1,147 @@
+package workqueue
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter decides how long a key waits before it is queued again.
+type RateLimiter interface {
+	// When returns how long key should wait and counts it as a retry.
+	When(key string) time.Duration
+	// Forget clears the retries of key, usually after it was processed
+	// successfully.
+	Forget(key string)
+	// NumRequeues returns how often key has been retried since it was last
+	// forgotten.
+	NumRequeues(key string) int
+}
+
+// DefaultRateLimiter backs off failing keys exponentially from one second to
+// five minutes, and holds retries across all keys to ten a second with
+// bursts of a hundred.
+func DefaultRateLimiter() RateLimiter {
+	return NewMaxOfRateLimiter(
+		NewItemExponentialRateLimiter(time.Second, 5*time.Minute),
+		NewBucketRateLimiter(10, 100),
+	)
+}
+
+// ItemExponentialRateLimiter doubles the delay of a key on every retry,
+// starting at base and capped at max.
+type ItemExponentialRateLimiter struct {
+	mu       sync.Mutex
+	failures map[string]int
+	base     time.Duration
+	max      time.Duration
+}
+
+func NewItemExponentialRateLimiter(base, max time.Duration) *ItemExponentialRateLimiter {
+	return &ItemExponentialRateLimiter{
+		failures: make(map[string]int),
+		base:     base,
+		max:      max,
+	}
+}
+
+func (l *ItemExponentialRateLimiter) When(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	exp := l.failures[key]
+	l.failures[key]++
+
+	d := l.base
+	for range exp {
+		if d >= l.max {
+			break
+		}
+		d *= 2
+	}
+	return min(d, l.max)
+}
+
+func (l *ItemExponentialRateLimiter) Forget(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+}
+
+func (l *ItemExponentialRateLimiter) NumRequeues(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.failures[key]
+}
+
+// BucketRateLimiter is a token bucket shared by all keys: it lets burst keys
+// through at once and qps a second after that.
+type BucketRateLimiter struct {
+	mu     sync.Mutex
+	qps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewBucketRateLimiter(qps float64, burst int) *BucketRateLimiter {
+	return &BucketRateLimiter{
+		qps:    qps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (l *BucketRateLimiter) When(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.qps)
+	l.last = now
+
+	// the token is taken now and paid back by waiting
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.qps * float64(time.Second))
+}
+
+func (l *BucketRateLimiter) Forget(key string) {}
+
+func (l *BucketRateLimiter) NumRequeues(key string) int {
+	return 0
+}
+
+// MaxOfRateLimiter makes a key wait as long as the strictest of its
+// limiters asks.
+type MaxOfRateLimiter struct {
+	limiters []RateLimiter
+}
+
+func NewMaxOfRateLimiter(limiters ...RateLimiter) *MaxOfRateLimiter {
+	return &MaxOfRateLimiter{limiters: limiters}
+}
+
+func (l *MaxOfRateLimiter) When(key string) time.Duration {
+	var d time.Duration
+	for _, limiter := range l.limiters {
+		d = max(d, limiter.When(key))
+	}
+	return d
+}
+
+func (l *MaxOfRateLimiter) Forget(key string) {
+	for _, limiter := range l.limiters {
+		limiter.Forget(key)
+	}
+}
+
+func (l *MaxOfRateLimiter) NumRequeues(key string) int {
+	var n int
+	for _, limiter := range l.limiters {
+		n = max(n, limiter.NumRequeues(key))
+	}
+	return n
+}
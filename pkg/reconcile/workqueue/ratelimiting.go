@@ -0,0 +1,98 @@
+package workqueue
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimitingQueue is a Queue whose keys can be added after a delay, and
+// retried after a delay chosen by a RateLimiter.
+type RateLimitingQueue struct {
+	*Queue
+	limiter RateLimiter
+
+	mu sync.Mutex
+	// waiting holds a timer for every key added with a delay that has not
+	// been queued yet, so that a key waits on one timer only.
+	waiting  map[string]*delayed
+	shutdown bool
+}
+
+type delayed struct {
+	timer   *time.Timer
+	readyAt time.Time
+}
+
+func NewRateLimiting(limiter RateLimiter) *RateLimitingQueue {
+	return &RateLimitingQueue{
+		Queue:   New(),
+		limiter: limiter,
+		waiting: make(map[string]*delayed),
+	}
+}
+
+// AddAfter queues key once d has passed. A key already waiting is queued at
+// the earlier of the two times.
+func (q *RateLimitingQueue) AddAfter(key string, d time.Duration) {
+	if d <= 0 {
+		q.Add(key)
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.shutdown {
+		return
+	}
+
+	readyAt := time.Now().Add(d)
+	if w, ok := q.waiting[key]; ok {
+		if !readyAt.Before(w.readyAt) {
+			return
+		}
+		w.timer.Stop()
+	}
+
+	w := &delayed{readyAt: readyAt}
+	w.timer = time.AfterFunc(d, func() {
+		q.mu.Lock()
+		if q.waiting[key] == w {
+			delete(q.waiting, key)
+		}
+		q.mu.Unlock()
+
+		q.Add(key)
+	})
+	q.waiting[key] = w
+}
+
+// AddRateLimited queues key again once the rate limiter allows it.
+func (q *RateLimitingQueue) AddRateLimited(key string) {
+	q.AddAfter(key, q.limiter.When(key))
+}
+
+// Forget clears the retries of key. Call it once key has been processed
+// successfully.
+func (q *RateLimitingQueue) Forget(key string) {
+	q.limiter.Forget(key)
+}
+
+// NumRequeues returns how often key has been retried since it was last
+// forgotten.
+func (q *RateLimitingQueue) NumRequeues(key string) int {
+	return q.limiter.NumRequeues(key)
+}
+
+// ShutDown stops waiting keys from being queued and shuts down the Queue.
+func (q *RateLimitingQueue) ShutDown() {
+	q.mu.Lock()
+	q.shutdown = true
+	for key, w := range q.waiting {
+		w.timer.Stop()
+		delete(q.waiting, key)
+	}
+	q.mu.Unlock()
+
+	q.Queue.ShutDown()
+}